@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/balebbae/sodia/internal/store"
+)
+
+type UpdateUserStatusPayload struct {
+	Status string `json:"status" validate:"required,oneof=active suspended"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// UpdateUserStatus godoc
+//
+//	@Summary		Suspends or reinstates a user
+//	@Description	Suspends or reinstates a user account. Suspended users can't log in and are signed out of every session. Admin only.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int						true	"User ID"
+//	@Param			payload	body		UpdateUserStatusPayload	true	"New status and reason"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/status [patch]
+func (app *application) updateUserStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateUserStatusPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	admin := getAuthUserFromContext(r)
+	user := getUserFromContext(r)
+
+	if admin.ID == user.ID {
+		app.badRequestResponse(w, r, errors.New("you can't change the status of your own account"))
+		return
+	}
+
+	suspended := payload.Status == "suspended"
+
+	err := app.store.Users.UpdateStatus(r.Context(), user.ID, admin.ID, suspended, payload.Reason)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Infow("user status changed", "user_id", user.ID, "admin_id", admin.ID, "status", payload.Status)
+
+	user.IsSuspended = suspended
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
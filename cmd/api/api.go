@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"net/http"
 	"time"
 
 	"github.com/balebbae/sodia/docs" // This is rquired to generate swagger docs
+	"github.com/balebbae/sodia/internal/auth"
 	"github.com/balebbae/sodia/internal/mailer"
+	"github.com/balebbae/sodia/internal/ratelimiter"
 	"github.com/balebbae/sodia/internal/store"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -21,6 +30,9 @@ type application struct {
 	store store.Storage
 	logger *zap.SugaredLogger
 	mailer mailer.Client
+	authenticator auth.Authenticator
+	invitationLimiter ratelimiter.Limiter
+	wg sync.WaitGroup
 }
 
 type config struct {
@@ -30,18 +42,86 @@ type config struct {
 	apiURL string
 	mail mailConfig
 	frontendURL string
+	auth authConfig
+	outbox outboxConfig
+	timeline timelineConfig
+	trash trashConfig
+	scheduler schedulerConfig
+}
+
+// schedulerConfig sets how often scheduled posts are checked for being due and
+// how many are published at a time.
+type schedulerConfig struct {
+	interval time.Duration
+	batchSize int
+}
+
+// trashConfig bounds how long deleted posts and comments can be restored and
+// how long they are kept before being purged.
+type trashConfig struct {
+	restoreWindow time.Duration
+	retention time.Duration
+	purgeInterval time.Duration
+}
+
+type timelineConfig struct {
+	fanOutLimit int
+	backfillLimit int
+}
+
+type outboxConfig struct {
+	pollInterval time.Duration
+	batchSize int
+	lease time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type authConfig struct {
+	token tokenConfig
+}
+
+type tokenConfig struct {
+	secret string
+	exp time.Duration
+	refreshExp time.Duration
+	iss string
+	aud string
 }
 
 type mailConfig struct {
+	provider string
 	sendGrid sendGridConfig
+	smtp smtpConfig
+	capture captureConfig
 	fromEmail string
 	exp time.Duration
+	resetExp time.Duration
+	sweepAfter time.Duration
+	sweepInterval time.Duration
+	resendLimit int
+	resendWindow time.Duration
 }
 
 type sendGridConfig struct {
 	apiKey string
 }
 
+type captureConfig struct {
+	dir string
+	size int
+}
+
+type smtpConfig struct {
+	host string
+	port int
+	username string
+	password string
+	tlsMode string
+	authMethod string
+}
+
 type dbConfig struct {
 	addr string
 	maxOpenConns int
@@ -69,49 +149,114 @@ func (app *application) mount() http.Handler {
 
         // You can also set a wildcard: []string{"*"}
 
-        AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-        AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-        ExposedHeaders:   []string{"Link"},
+        AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+        AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match"},
+        ExposedHeaders:   []string{"Link", "ETag"},
         AllowCredentials: false,
         MaxAge:           300, // 300 seconds = 5 minutes
     }))
 
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/health", app.healthCheckHandler)
+
+		if app.config.env != "production" {
+			r.Get("/debug/vars", expvar.Handler().ServeHTTP)
+		}
+
+		// captured mail holds activation and reset links
+		if app.config.env == "development" {
+			r.Get("/debug/mail", app.getCapturedMailHandler)
+		}
 		
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
 
 		r.Route("/posts", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
 			r.Post("/", app.createPostHandler) // POST /v1/Posts
 			r.Route("/{postID}", func(r chi.Router) { // WE will need postID more later
-				r.Use(app.postsContextMiddleware)
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.updatePostHandler)
-				r.Delete("/", app.deletePostHandler)
+				r.With(app.trashedPostContextMiddleware).Post("/restore", app.checkPostOwnership("moderator", app.restorePostHandler))
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.postsContextMiddleware)
+					r.Get("/", app.getPostHandler)
+					r.Patch("/", app.checkPostOwnership("", app.updatePostHandler))
+					r.Delete("/", app.checkPostOwnership("moderator", app.deletePostHandler))
+					r.Put("/pin", app.checkPostOwnership("", app.pinPostHandler))
+					r.Delete("/pin", app.checkPostOwnership("", app.unpinPostHandler))
+					r.Get("/revisions", app.getPostRevisionsHandler)
+					r.Get("/revisions/{version}", app.getPostRevisionHandler)
+					r.Get("/revisions/{version}/diff", app.diffPostRevisionsHandler)
 
-				//Comments
-				r.Post("/comments", app.createCommentHandler)
+					//Comments
+					r.Post("/comments", app.createCommentHandler)
+					r.Route("/comments/{commentID}", func(r chi.Router) {
+						r.With(app.trashedCommentContextMiddleware).Post("/restore", app.checkCommentOwnership("moderator", app.restoreCommentHandler))
+						r.With(app.commentsContextMiddleware).Delete("/", app.checkCommentOwnership("moderator", app.deleteCommentHandler))
+					})
+				})
 			})
 		})
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
 
 			r.Route("/{userID}", func(r chi.Router) { 
+				r.Use(app.AuthTokenMiddleware)
 				r.Use(app.userContextMiddleware)
 				r.Get("/", app.getUserHandler)
+				r.Get("/posts", app.getUserPostsHandler)
 				r.Put("/follow", app.followUserHandler)
 				r.Put("/unfollow", app.unfollowUserHandler)
 			})
 
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Get("/sessions", app.getSessionsHandler)
+				r.Get("/drafts", app.getDraftsHandler)
+				r.Delete("/sessions/{sessionID}", app.deleteSessionHandler)
+			})
+
 			r.Group(func(r chi.Router){
+				r.Use(app.AuthTokenMiddleware)
 				r.Get("/feed", app.getUserFeedHandler)
 			})
 		})
 
+		r.Route("/search", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/posts", app.searchPostsHandler)
+			r.Get("/users", app.searchUsersHandler)
+		})
+
+		r.Route("/tags", func(r chi.Router) {
+			r.Get("/trending", app.getTrendingTagsHandler)
+			r.Get("/{tag}/posts", app.getTagPostsHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Put("/{tag}/follow", app.followTagHandler)
+				r.Delete("/{tag}/follow", app.unfollowTagHandler)
+			})
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Route("/users/{userID}", func(r chi.Router) {
+				r.Use(app.userContextMiddleware)
+				r.Patch("/status", app.checkRole("admin", app.updateUserStatusHandler))
+			})
+		})
+
 		// Public Routes
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
+			r.Post("/token", app.createTokenHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.Post("/password/forgot", app.forgotPasswordHandler)
+			r.Post("/password/reset", app.resetPasswordHandler)
+			r.Post("/invitation/resend", app.resendInvitationHandler)
 		})
 	})
 
@@ -132,9 +277,53 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout: time.Minute,
 	}
 
+	shutdown := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		app.logger.Infow("signal caught", "signal", s.String())
+
+		shutdown <- server.Shutdown(ctx)
+	}()
+
 	app.logger.Infow("server has started", "addr", app.config.addr, "env", app.config.env)
 
-	return server.ListenAndServe()
+	err := server.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	if err := <-shutdown; err != nil {
+		return err
+	}
+
+	app.logger.Infow("server has stopped", "addr", app.config.addr, "env", app.config.env)
+
+	return nil
+}
+
+// background runs fn in a goroutine that shutdown waits for.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Errorw("background task panicked", "error", err)
+			}
+		}()
+
+		fn()
+	}()
 }
 
 // create user(user struct, *db.DB){
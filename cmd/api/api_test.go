@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/balebbae/sodia/internal/auth"
+	"github.com/balebbae/sodia/internal/db/dbtest"
+	"github.com/balebbae/sodia/internal/mailer"
+	"github.com/balebbae/sodia/internal/ratelimiter"
+	"github.com/balebbae/sodia/internal/store"
+	"go.uber.org/zap"
+)
+
+// newTestApplication wires the API to a throwaway database and the capture
+// mailer, the way it runs in development.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	db := dbtest.New(t)
+
+	templates, err := mailer.ParseTemplates(mailer.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailClient, err := mailer.NewCapture("", 10, "test@sodia.local", templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{
+		env: "development",
+		frontendURL: "http://localhost:5173",
+		mail: mailConfig{
+			exp: time.Hour,
+			resetExp: time.Hour,
+			resendLimit: 3,
+			resendWindow: time.Hour,
+		},
+		auth: authConfig{
+			token: tokenConfig{
+				secret: "test",
+				exp: time.Minute,
+				refreshExp: time.Hour,
+				iss: "sodia",
+				aud: "sodia",
+			},
+		},
+		outbox: outboxConfig{
+			batchSize: 10,
+			lease: time.Minute,
+			maxAttempts: 1,
+			baseBackoff: time.Second,
+			maxBackoff: time.Second,
+		},
+	}
+
+	return &application{
+		config: cfg,
+		store: store.NewStorage(db, store.Config{}),
+		logger: zap.NewNop().Sugar(),
+		mailer: mailClient,
+		authenticator: auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.aud, cfg.auth.token.iss),
+		invitationLimiter: ratelimiter.NewFixedWindowLimiter(cfg.mail.resendLimit, cfg.mail.resendWindow),
+	}
+}
+
+// do sends a JSON request to the mux and decodes the "data" envelope of the
+// response into out, when given.
+func do(t *testing.T, mux http.Handler, method, path, token string, body any, out any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if out != nil && rr.Code < 300 {
+		envelope := struct {
+			Data any `json:"data"`
+		}{Data: out}
+		if err := json.NewDecoder(rr.Body).Decode(&envelope); err != nil {
+			t.Fatalf("decoding %s %s: %v", method, path, err)
+		}
+	}
+
+	return rr
+}
+
+// capturedLink delivers the queued emails and returns the first link of the
+// newest one sent to email whose URL contains prefix.
+func capturedLink(t *testing.T, app *application, mux http.Handler, email, prefix string) string {
+	t.Helper()
+
+	app.drainEmailOutbox(context.Background())
+
+	var messages []mailer.CapturedMessage
+	if rr := do(t, mux, http.MethodGet, "/v1/debug/mail", "", nil, &messages); rr.Code != http.StatusOK {
+		t.Fatalf("GET /v1/debug/mail: got status %d", rr.Code)
+	}
+
+	for _, msg := range messages {
+		if len(msg.To) == 0 || msg.To[0].Email != email {
+			continue
+		}
+		for _, link := range msg.Links {
+			if strings.Contains(link, prefix) {
+				return link
+			}
+		}
+	}
+
+	t.Fatalf("no captured email to %s with a %q link", email, prefix)
+	return ""
+}
+
+// login registers and activates a user through captured mail and returns
+// their access token.
+func login(t *testing.T, app *application, mux http.Handler, username string) string {
+	t.Helper()
+
+	register := RegisterUserPayload{Username: username, Email: username + "@example.com", Password: "secret"}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/user", "", register, nil); rr.Code != http.StatusCreated {
+		t.Fatalf("register: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	activation := path.Base(capturedLink(t, app, mux, register.Email, "/confirm/"))
+	if rr := do(t, mux, http.MethodPut, "/v1/users/activate/"+activation, "", nil, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("activate: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	var tokens TokenPair
+	credentials := CreateUserTokenPayload{Email: register.Email, Password: register.Password}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/token", "", credentials, &tokens); rr.Code != http.StatusOK {
+		t.Fatalf("login: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	return tokens.Token
+}
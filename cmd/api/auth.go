@@ -4,10 +4,13 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/balebbae/sodia/internal/mailer"
 	"github.com/balebbae/sodia/internal/store"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -62,11 +65,18 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	plainToken := uuid.New().String()
 	
 	// Store token in DB encrypted 
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
+	hashedToken := hashToken(plainToken)
+
+	// Queue the welcome email in the same transaction as the user so it is never lost
+	email := &store.OutboxEmail{
+		Template: mailer.UserWelcomeTemplate,
+		Username: user.Username,
+		Email: user.Email,
+		Data: app.welcomeEmailVars(user, plainToken),
+	}
 
 	// Store the user
-	err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp)
+	err := app.store.Users.CreateAndInvite(ctx, user, hashedToken, app.config.mail.exp, email)
 	if err != nil {
 		switch err {
 		case store.ErrDuplicateEmail:
@@ -83,32 +93,205 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		User: user,
 		Token: plainToken,
 	}
-	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
 
-	isProdEnv := app.config.env == "production"
-	vars := struct{
-		Username string 
-		ActivationURL string
-	} {
-		Username: user.Username,
-		ActivationURL: activationURL,
+	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type CreateUserTokenPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+type TokenPair struct {
+	Token string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// CreateToken godoc
+//
+//	@Summary		Creates a token
+//	@Description	Creates an access token and a refresh token for a user
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateUserTokenPayload	true	"User credentials"
+//	@Success		200		{object}	TokenPair				"Tokens"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error	"Account not activated or suspended"
+//	@Failure		500		{object}	error
+//	@Router			/authentication/token [post]
+func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateUserTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
-	// Send mail 
-	err = app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
 	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
 
-		// rollback user creation if email fails (SAGA Pattern)
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
+	if err := checkAccountStatus(user); err != nil {
+		app.inactiveAccountResponse(w, r, err)
+		return
+	}
+
+	refreshToken := uuid.New().String()
+
+	session := &store.Session{
+		UserID: user.ID,
+		UserAgent: r.UserAgent(),
+		IP: clientIP(r),
+	}
+
+	err = app.store.Sessions.Create(ctx, session, hashToken(refreshToken), app.config.auth.token.refreshExp)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	token, err := app.generateAccessToken(user.ID, session.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens := TokenPair{
+		Token: token,
+		RefreshToken: refreshToken,
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// RefreshToken godoc
+//
+//	@Summary		Refreshes a token
+//	@Description	Exchanges a refresh token for a new access token and refresh token. Each refresh token can only be used once.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@Success		200		{object}	TokenPair			"Tokens"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	refreshToken := uuid.New().String()
+
+	session, err := app.store.Sessions.Rotate(
+		r.Context(),
+		hashToken(payload.RefreshToken),
+		hashToken(refreshToken),
+		app.config.auth.token.refreshExp,
+	)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		case store.ErrTokenReused:
+			app.logger.Warnw("refresh token reused, session revoked", "ip", clientIP(r))
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
 		}
+		return
+	}
 
+	token, err := app.generateAccessToken(session.UserID, session.ID)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
+	tokens := TokenPair{
+		Token: token,
+		RefreshToken: refreshToken,
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
 		app.internalServerError(w, r, err)
 	}
-}
\ No newline at end of file
+}
+
+func (app *application) generateAccessToken(userID, sessionID int64) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"sid": sessionID,
+		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.aud,
+	}
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+func (app *application) welcomeEmailVars(user *store.User, plainToken string) any {
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
+
+	return struct{
+		Username string 
+		ActivationURL string
+	} {
+		Username: user.Username,
+		ActivationURL: activationURL,
+	}
+}
+
+// hashToken returns the SHA-256 of a plain token, which is what we store in the DB.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// clientIP returns the address of the client without its port. RealIP may
+// already have replaced RemoteAddr with a bare address from a proxy header.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
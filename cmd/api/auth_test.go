@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"testing"
+)
+
+func TestActivationThroughCapturedMail(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	register := RegisterUserPayload{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/user", "", register, nil); rr.Code != http.StatusCreated {
+		t.Fatalf("register: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	credentials := CreateUserTokenPayload{Email: register.Email, Password: register.Password}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/token", "", credentials, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("login before activation: got status %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	token := path.Base(capturedLink(t, app, mux, register.Email, "/confirm/"))
+
+	if rr := do(t, mux, http.MethodPut, "/v1/users/activate/"+token, "", nil, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("activate: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	var tokens TokenPair
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/token", "", credentials, &tokens); rr.Code != http.StatusOK {
+		t.Fatalf("login after activation: got status %d: %s", rr.Code, rr.Body)
+	}
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("login returned an empty token pair: %+v", tokens)
+	}
+}
+
+func TestPasswordResetThroughCapturedMail(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	register := RegisterUserPayload{Username: "bob", Email: "bob@example.com", Password: "secret"}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/user", "", register, nil); rr.Code != http.StatusCreated {
+		t.Fatalf("register: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	activation := path.Base(capturedLink(t, app, mux, register.Email, "/confirm/"))
+	if rr := do(t, mux, http.MethodPut, "/v1/users/activate/"+activation, "", nil, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("activate: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	forgot := ForgotPasswordPayload{Email: register.Email}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/password/forgot", "", forgot, nil); rr.Code != http.StatusAccepted {
+		t.Fatalf("forgot password: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	reset := ResetPasswordPayload{
+		Token: path.Base(capturedLink(t, app, mux, register.Email, "/reset-password/")),
+		Password: "new-secret",
+	}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/password/reset", "", reset, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("reset password: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	old := CreateUserTokenPayload{Email: register.Email, Password: register.Password}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/token", "", old, nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("login with old password: got status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	updated := CreateUserTokenPayload{Email: register.Email, Password: reset.Password}
+	if rr := do(t, mux, http.MethodPost, "/v1/authentication/token", "", updated, nil); rr.Code != http.StatusOK {
+		t.Fatalf("login with new password: got status %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestCapturedMailHiddenOutsideDevelopment(t *testing.T) {
+	app := &application{config: config{env: "staging"}}
+
+	if rr := do(t, app.mount(), http.MethodGet, "/v1/debug/mail", "", nil, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("GET /v1/debug/mail in staging: got status %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestAccessTokenWithoutSessionIsRejected(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	if rr := do(t, mux, http.MethodGet, "/v1/users/me/sessions", login(t, app, mux, "carol"), nil, nil); rr.Code != http.StatusOK {
+		t.Fatalf("with a session: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	user, err := app.store.Users.GetByEmail(context.Background(), "carol@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.generateAccessToken(user.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := do(t, mux, http.MethodGet, "/v1/users/me/sessions", token, nil, nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("without a session: got status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/balebbae/sodia/internal/mailer"
+)
+
+// GetCapturedMail godoc
+//
+//	@Summary		Lists captured emails
+//	@Description	Lists the emails captured by the development mailer, newest first. Only available in development with MAIL_PROVIDER=capture.
+//	@Tags			debug
+//	@Produce		json
+//	@Success		200	{object}	[]mailer.CapturedMessage
+//	@Failure		404	{object}	error
+//	@Router			/debug/mail [get]
+func (app *application) getCapturedMailHandler(w http.ResponseWriter, r *http.Request) {
+	inbox, ok := app.mailer.(mailer.Inbox)
+	if !ok {
+		app.notFoundResponse(w, r, errors.New("mailer does not capture messages"))
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, inbox.Messages()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
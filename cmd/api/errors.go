@@ -1,7 +1,20 @@
 package main
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/balebbae/sodia/internal/store"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	errAccountNotActivated = errors.New("account is not activated")
+	errAccountSuspended = errors.New("account is suspended")
+	errVersionMismatch = errors.New("the resource has changed since it was fetched")
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -30,4 +43,92 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request,
 
 	writeJSONError(w, http.StatusNotFound, 
 	"not found")
-}
\ No newline at end of file
+}
+
+func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusUnauthorized, 
+	"unauthorized")
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warnw("forbidden", "method", r.Method, "path", r.URL.Path)
+
+	writeJSONError(w, http.StatusForbidden, 
+	"forbidden")
+}
+
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+	app.logger.Warnw("failed validation", "method", r.Method, "path", r.URL.Path, "fields", fields)
+
+	type envelope struct {
+		Error string `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+
+	writeJSON(w, http.StatusBadRequest, &envelope{Error: "validation failed", Fields: fields})
+}
+
+// validationErrorResponse reports parse or validation errors field by field
+// when it can, and falls back to a plain bad request otherwise.
+func (app *application) validationErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var fieldErrs store.FieldErrors
+	if errors.As(err, &fieldErrs) {
+		app.failedValidationResponse(w, r, fieldErrs)
+		return
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		app.failedValidationResponse(w, r, validationFieldErrors(validationErrs))
+		return
+	}
+
+	app.badRequestResponse(w, r, err)
+}
+
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("inactive account", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusForbidden, 
+	err.Error())
+}
+
+// checkAccountStatus returns errAccountNotActivated or errAccountSuspended when
+// the user isn't allowed to act on their account.
+func checkAccountStatus(user *store.User) error {
+	switch {
+	case !user.IsActive:
+		return errAccountNotActivated
+	case user.IsSuspended:
+		return errAccountSuspended
+	default:
+		return nil
+	}
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	app.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path)
+
+	// Retry-After is in whole seconds, rounded up so clients don't retry early
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	w.Header().Set("Retry-After", seconds)
+
+	writeJSONError(w, http.StatusTooManyRequests, 
+	"rate limit exceeded, retry after: "+seconds+"s")
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("precondition failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusPreconditionFailed, 
+	err.Error())
+}
+
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warnw("precondition required", "method", r.Method, "path", r.URL.Path)
+
+	writeJSONError(w, http.StatusPreconditionRequired, 
+	"the If-Match header is required, send the ETag of the version you are updating")
+}
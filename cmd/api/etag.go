@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/balebbae/sodia/internal/store"
+)
+
+// postETag is the entity tag of a post as served by GET, comments included,
+// so it changes whenever the response would: edits, pins, publishing and
+// comments alike. It starts with the post's version, which is all If-Match
+// checks, see versionMatches.
+func postETag(post *store.Post, comments []store.Comment) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%s|%s", post.Version, post.UpdatedAt, post.Status)
+	if post.PinnedAt != nil {
+		fmt.Fprintf(h, "|pinned:%s", *post.PinnedAt)
+	}
+
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		fmt.Fprintf(h, "|%d", id)
+	}
+
+	return `"` + strconv.Itoa(post.Version) + "-" + hex.EncodeToString(h.Sum(nil)[:8]) + `"`
+}
+
+// etagMatches reports whether a list of entity tags from an If-None-Match
+// header includes etag. Weak tags match their strong equivalent, as
+// If-None-Match asks.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// versionMatches reports whether an If-Match header includes an entity tag
+// of the post at version. Only the version is compared, so comments or a pin
+// added since the post was fetched don't fail an edit of it.
+func versionMatches(header string, version int) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		// weak tags never match If-Match
+		tag, ok := strings.CutPrefix(tag, `"`)
+		if !ok {
+			continue
+		}
+
+		v, _, _ := strings.Cut(strings.TrimSuffix(tag, `"`), "-")
+		if v == strconv.Itoa(version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified answers a conditional GET whose If-None-Match includes etag.
+// It returns false when the full response should be sent.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatches(header, etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
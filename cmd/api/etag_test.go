@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/balebbae/sodia/internal/store"
+)
+
+func TestPostETagTracksTheWholeResponse(t *testing.T) {
+	pinnedAt := "2024-05-01T10:00:00Z"
+	post := store.Post{ID: 1, Version: 2, UpdatedAt: "2024-05-01T09:00:00Z", Status: store.PostStatusPublished}
+	comments := []store.Comment{{ID: 10}, {ID: 11}}
+
+	base := postETag(&post, comments)
+
+	if got := postETag(&post, []store.Comment{{ID: 11}, {ID: 10}}); got != base {
+		t.Errorf("ETag depends on comment order: %s != %s", got, base)
+	}
+
+	pinned := post
+	pinned.PinnedAt = &pinnedAt
+	scheduled := post
+	scheduled.Status = store.PostStatusScheduled
+	edited := post
+	edited.Version++
+
+	changes := map[string]string{
+		"comment added": postETag(&post, append(comments, store.Comment{ID: 12})),
+		"comment deleted": postETag(&post, comments[:1]),
+		"post pinned": postETag(&pinned, comments),
+		"status changed": postETag(&scheduled, comments),
+		"post edited": postETag(&edited, comments),
+	}
+
+	for change, etag := range changes {
+		if etag == base {
+			t.Errorf("ETag unchanged after %s", change)
+		}
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	etag := `"3-abc"`
+
+	tests := []struct {
+		header string
+		want bool
+	}{
+		{`"3-abc"`, true},
+		{`"1-xyz", "3-abc"`, true},
+		{`*`, true},
+		{`W/"3-abc"`, true},
+		{`"3-abd"`, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%s) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want bool
+	}{
+		{`"3-abc"`, true},
+		{`"3-def"`, true},
+		{`"1-xyz", "3-abc"`, true},
+		{`*`, true},
+		{`W/"3-abc"`, false},
+		{`"4-abc"`, false},
+		{`"31-abc"`, false},
+		{`3`, false},
+	}
+
+	for _, tt := range tests {
+		if got := versionMatches(tt.header, 3); got != tt.want {
+			t.Errorf("versionMatches(%s, 3) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestEditSurvivesNewComments(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	alice := login(t, app, mux, "alice")
+	bob := login(t, app, mux, "bob")
+
+	var post store.Post
+	created := CreatePostPayload{Title: "hello", Content: "hello"}
+	if rr := do(t, mux, http.MethodPost, "/v1/posts", alice, created, &post); rr.Code != http.StatusCreated {
+		t.Fatalf("create: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	postPath := "/v1/posts/" + strconv.FormatInt(post.ID, 10)
+
+	rr := do(t, mux, http.MethodGet, postPath, alice, nil, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get: got status %d: %s", rr.Code, rr.Body)
+	}
+	etag := rr.Header().Get("ETag")
+
+	comment := CreateCommentPayload{Content: "first"}
+	if rr := do(t, mux, http.MethodPost, postPath+"/comments", bob, comment, nil); rr.Code != http.StatusCreated {
+		t.Fatalf("comment: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	// the comment changes what GET serves, not the post being edited
+	if rr := do(t, mux, http.MethodGet, postPath, alice, nil, nil); rr.Header().Get("ETag") == etag {
+		t.Errorf("ETag unchanged after a comment")
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, postPath, strings.NewReader(`{"title": "edited"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+alice)
+	req.Header.Set("If-Match", etag)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("edit with the ETag from before the comment: got status %d: %s", rr.Code, rr.Body)
+	}
+}
@@ -9,20 +9,23 @@ import (
 // getUserFeedHandler godoc
 //
 //	@Summary		Fetches the user feed
-//	@Description	Fetches the user feed
+//	@Description	Fetches the posts of the accounts and tags the user follows, plus their own. Each post's reason says why it was included: own, followed_user or followed_tag. Pages are walked with the next_cursor and prev_cursor of the response, also sent as Link headers.
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
-//	@Param			since	query		string	false	"Since"
-//	@Param			until	query		string	false	"Until"
-//	@Param			limit	query		int		false	"Limit"
-//	@Param			offset	query		int		false	"Offset"
-//	@Param			sort	query		string	false	"Sort"
-//	@Param			tags	query		string	false	"Tags"
-//	@Param			search	query		string	false	"Search"
-//	@Success		200		{object}	[]store.PostWithMetadata
-//	@Failure		400		{object}	error
-//	@Failure		500		{object}	error
+//	@Param			since		query		string	false	"Only posts created at or after this time (RFC 3339 or YYYY-MM-DD HH:MM:SS)"
+//	@Param			until		query		string	false	"Only posts created at or before this time (RFC 3339 or YYYY-MM-DD HH:MM:SS)"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Param			sort		query		string	false	"Sort"
+//	@Param			rank		query		string	false	"Ranking: latest (default), top, relevant or search, which orders by how well posts match the search"
+//	@Param			tags		query		string	false	"Tags"
+//	@Param			search		query		string	false	"Full-text search terms in web search syntax"
+//	@Param			cursor		query		string	false	"Opaque cursor from next_cursor or prev_cursor"
+//	@Param			exclude_own	query		bool	false	"Leave out the user's own posts"
+//	@Success		200			{object}	[]store.PostWithMetadata
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
@@ -30,31 +33,32 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		Limit:  20,
 		Offset: 0,
 		Sort:   "desc",
+		Rank:   store.RankLatest,
 		Tags:   []string{},
 		Search: "",
 	}
 
 	fq, err := fq.Parse(r)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.validationErrorResponse(w, r, err)
 		return
 	}
 
 	if err := Validate.Struct(fq); err != nil {
-		app.badRequestResponse(w, r, err)
+		app.validationErrorResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
-	user := getUserFromContext(r)
+	user := getAuthUserFromContext(r)
 
-	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
+	feed, page, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	if err := app.paginatedJSONResponse(w, r, http.StatusOK, feed, page); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
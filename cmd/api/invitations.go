@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/balebbae/sodia/internal/mailer"
+	"github.com/balebbae/sodia/internal/store"
+	"github.com/google/uuid"
+)
+
+type ResendInvitationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// ResendInvitation godoc
+//
+//	@Summary		Resends an activation email
+//	@Description	Revokes any pending invitation and emails a new activation link. Always responds 202 so it can't be used to find out which emails are registered.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResendInvitationPayload	true	"User email"
+//	@Success		202		{string}	string					"Invitation resent"
+//	@Failure		400		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/invitation/resend [post]
+func (app *application) resendInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendInvitationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if allow, retryAfter := app.invitationLimiter.Allow(strings.ToLower(payload.Email)); !allow {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if user.IsActive {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	plainToken := uuid.New().String()
+
+	email := &store.OutboxEmail{
+		Template: mailer.UserWelcomeTemplate,
+		Username: user.Username,
+		Email: user.Email,
+		Data: app.welcomeEmailVars(user, plainToken),
+	}
+
+	err = app.store.Users.ResendInvitation(ctx, user.ID, hashToken(plainToken), app.config.mail.exp, email)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sweepUnactivatedUsers periodically deletes accounts whose invitations expired
+// long ago without being used, until ctx is cancelled.
+func (app *application) sweepUnactivatedUsers(ctx context.Context) {
+	ticker := time.NewTicker(app.config.mail.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := app.store.Users.DeleteUnactivated(ctx, app.config.mail.sweepAfter)
+			if err != nil {
+				app.logger.Errorw("error sweeping unactivated users", "error", err)
+				continue
+			}
+
+			if deleted > 0 {
+				app.logger.Infow("swept unactivated users", "count", deleted)
+			}
+		}
+	}
+}
@@ -5,6 +5,10 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/balebbae/sodia/internal/store"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -12,6 +16,41 @@ var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// report fields by the name clients know them by
+	Validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+// validationFieldErrors turns validator errors into a message per field.
+func validationFieldErrors(errs validator.ValidationErrors) map[string]string {
+	fields := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		var msg string
+		switch fe.Tag() {
+		case "required":
+			msg = "is required"
+		case "gte", "min":
+			msg = "must be at least " + fe.Param()
+		case "lte", "max":
+			msg = "must be at most " + fe.Param()
+		case "oneof":
+			msg = "must be one of: " + fe.Param()
+		case "email":
+			msg = "must be a valid email address"
+		default:
+			msg = "failed the " + fe.Tag() + " check"
+		}
+
+		fields[fe.Field()] = msg
+	}
+
+	return fields
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -44,4 +83,42 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 	}
 
 	return writeJSON(w, status, &envelope{Data: data})
-}
\ No newline at end of file
+}
+
+// paginatedJSONResponse is jsonResponse for cursor paginated lists. The
+// cursors are also advertised as RFC 8288 Link headers.
+func (app *application) paginatedJSONResponse(w http.ResponseWriter, r *http.Request, status int, data any, page store.Page) error {
+	type envelope struct {
+		Data any `json:"data"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		PrevCursor string `json:"prev_cursor,omitempty"`
+	}
+
+	var links []string
+	if page.NextCursor != "" {
+		links = append(links, `<`+cursorURL(r, page.NextCursor)+`>; rel="next"`)
+	}
+	if page.PrevCursor != "" {
+		links = append(links, `<`+cursorURL(r, page.PrevCursor)+`>; rel="prev"`)
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	return writeJSON(w, status, &envelope{
+		Data: data,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	})
+}
+
+// cursorURL is the request URL pointed at another page.
+func cursorURL(r *http.Request, cursor string) string {
+	u := *r.URL
+	qs := u.Query()
+	qs.Set("cursor", cursor)
+	qs.Del("offset")
+	u.RawQuery = qs.Encode()
+
+	return u.RequestURI()
+}
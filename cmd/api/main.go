@@ -3,18 +3,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/balebbae/sodia/internal/auth"
 	"github.com/balebbae/sodia/internal/db"
 	"github.com/balebbae/sodia/internal/env"
 	"github.com/balebbae/sodia/internal/mailer"
+	"github.com/balebbae/sodia/internal/ratelimiter"
 	"github.com/balebbae/sodia/internal/store"
 	"go.uber.org/zap"
 )
 
 const version = "0.0.2"
 
+// defaultTokenSecret signs tokens when AUTH_TOKEN_SECRET isn't set. It is
+// public, so production refuses to start with it.
+const defaultTokenSecret = "example"
+
 //	@title			Sodia API
 //	@description	API for Social Media app Sodia.
 //	@termsOfService	http://swagger.io/terms/
@@ -33,6 +40,14 @@ const version = "0.0.2"
 //	@name						Authorization
 //	@description
 func main() {
+	appEnv := env.GetString("ENV", "development")
+
+	// Never reach out to a real provider in development unless asked to
+	defaultMailProvider := "sendgrid"
+	if appEnv == "development" {
+		defaultMailProvider = "capture"
+	}
+
 	cfg := config{
 		addr: env.GetString("ADDR", ":8080"),
 		apiURL: env.GetString("EXTERNAL_URL", "localhost:8080"),
@@ -43,22 +58,74 @@ func main() {
 			maxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 30),
 			maxIdleTime: env.GetString("DB_MAX_IDLE_TIME", "15m"),
 		},
-		env: env.GetString("ENV", "development"),
+		env: appEnv,
 		mail: mailConfig{
 			exp: time.Hour * 24 * 3, // 3 days
+			resetExp: time.Hour,
+			sweepAfter: env.GetDuration("MAIL_INVITATION_SWEEP_AFTER", time.Hour * 24 * 7), // 7 days
+			sweepInterval: env.GetDuration("MAIL_INVITATION_SWEEP_INTERVAL", time.Hour),
+			resendLimit: env.GetInt("MAIL_INVITATION_RESEND_LIMIT", 3),
+			resendWindow: env.GetDuration("MAIL_INVITATION_RESEND_WINDOW", time.Hour),
 			fromEmail: env.GetString("FROM_EMAIL", ""),
+			provider: env.GetString("MAIL_PROVIDER", defaultMailProvider),
 			sendGrid: sendGridConfig{
 				apiKey: env.GetString("SENDGRID_API_KEY", ""),
 			},
+			smtp: smtpConfig{
+				host: env.GetString("SMTP_HOST", "localhost"),
+				port: env.GetInt("SMTP_PORT", 1025), // MailHog
+				username: env.GetString("SMTP_USERNAME", ""),
+				password: env.GetString("SMTP_PASSWORD", ""),
+				tlsMode: env.GetString("SMTP_TLS_MODE", mailer.TLSModeNone),
+				authMethod: env.GetString("SMTP_AUTH_METHOD", mailer.AuthPlain),
+			},
+			capture: captureConfig{
+				dir: env.GetString("MAIL_CAPTURE_DIR", ""),
+				size: env.GetInt("MAIL_CAPTURE_SIZE", 100),
+			},
+		},
+		auth: authConfig{
+			token: tokenConfig{
+				secret: env.GetString("AUTH_TOKEN_SECRET", defaultTokenSecret),
+				exp: env.GetDuration("AUTH_TOKEN_EXP", time.Minute * 15),
+				refreshExp: env.GetDuration("AUTH_REFRESH_TOKEN_EXP", time.Hour * 24 * 30), // 30 days
+				iss: env.GetString("AUTH_TOKEN_ISS", "sodia"),
+				aud: env.GetString("AUTH_TOKEN_AUD", "sodia"),
+			},
+		},
+		timeline: timelineConfig{
+			fanOutLimit: env.GetInt("TIMELINE_FAN_OUT_LIMIT", 10_000),
+			backfillLimit: env.GetInt("TIMELINE_BACKFILL_LIMIT", 100),
+		},
+		outbox: outboxConfig{
+			pollInterval: env.GetDuration("OUTBOX_POLL_INTERVAL", time.Second * 5),
+			batchSize: env.GetInt("OUTBOX_BATCH_SIZE", 20),
+			lease: env.GetDuration("OUTBOX_LEASE", time.Minute),
+			maxAttempts: env.GetInt("OUTBOX_MAX_ATTEMPTS", 8),
+			baseBackoff: env.GetDuration("OUTBOX_BASE_BACKOFF", time.Second * 30),
+			maxBackoff: env.GetDuration("OUTBOX_MAX_BACKOFF", time.Hour),
+		},
+		trash: trashConfig{
+			restoreWindow: env.GetDuration("TRASH_RESTORE_WINDOW", time.Hour * 24 * 7), // 7 days
+			retention: env.GetDuration("TRASH_RETENTION", time.Hour * 24 * 30), // 30 days
+			purgeInterval: env.GetDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		},
+		scheduler: schedulerConfig{
+			interval: env.GetDuration("SCHEDULER_INTERVAL", time.Second * 30),
+			batchSize: env.GetInt("SCHEDULER_BATCH_SIZE", 50),
 		},
 	}
 	
 
-	fmt.Println(env.GetString("ENV", "development"))
+	fmt.Println(cfg.env)
 	// Logger
 	logger := zap.Must(zap.NewProduction()).Sugar()
 	defer logger.Sync()
 
+	if cfg.env == "production" && (cfg.auth.token.secret == "" || cfg.auth.token.secret == defaultTokenSecret) {
+		logger.Fatal("AUTH_TOKEN_SECRET must be set in production")
+	}
+
 	// Database
 	db, err := db.New(
 		cfg.db.addr,
@@ -73,18 +140,83 @@ func main() {
 	defer db.Close()
 	logger.Info("db connection established")
 
-	store := store.NewStorage(db)
+	storage := store.NewStorage(db, store.Config{
+		TimelineFanOutLimit: cfg.timeline.fanOutLimit,
+		TimelineBackfillLimit: cfg.timeline.backfillLimit,
+	})
 	
-	mailer := mailer.NewSendGrid(cfg.mail.sendGrid.apiKey, cfg.mail.fromEmail)
+	// Mailer
+	templates, err := mailer.ParseTemplates(mailer.FS)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	var mailClient mailer.Client
+	switch cfg.mail.provider {
+	case "sendgrid":
+		mailClient = mailer.NewSendGrid(cfg.mail.sendGrid.apiKey, cfg.mail.fromEmail, templates, logger)
+	case "smtp":
+		mailClient, err = mailer.NewSMTP(mailer.SMTPConfig{
+			Host: cfg.mail.smtp.host,
+			Port: cfg.mail.smtp.port,
+			Username: cfg.mail.smtp.username,
+			Password: cfg.mail.smtp.password,
+			TLSMode: cfg.mail.smtp.tlsMode,
+			AuthMethod: cfg.mail.smtp.authMethod,
+		}, cfg.mail.fromEmail, templates, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "capture":
+		mailClient, err = mailer.NewCapture(cfg.mail.capture.dir, cfg.mail.capture.size, cfg.mail.fromEmail, templates)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	default:
+		logger.Fatalf("unknown mail provider %q", cfg.mail.provider)
+	}
+
+	jwtAuthenticator := auth.NewJWTAuthenticator(
+		cfg.auth.token.secret,
+		cfg.auth.token.aud,
+		cfg.auth.token.iss,
+	)
 
 	app := &application{
 		config: cfg,
-		store: store,
+		store: storage,
 		logger: logger,
-		mailer: mailer,
+		mailer: mailClient,
+		authenticator: jwtAuthenticator,
+		invitationLimiter: ratelimiter.NewFixedWindowLimiter(
+			cfg.mail.resendLimit,
+			cfg.mail.resendWindow,
+		),
 	}
 
+	// Background jobs
+	ctx, cancel := context.WithCancel(context.Background())
+
+	app.background(func() {
+		app.sweepUnactivatedUsers(ctx)
+	})
+	app.background(func() {
+		app.runEmailOutbox(ctx)
+	})
+	app.background(func() {
+		app.purgeTrash(ctx)
+	})
+	app.background(func() {
+		app.runPostScheduler(ctx)
+	})
+
 	mux := app.mount()
 
-	logger.Fatal(app.run(mux))
+	if err := app.run(mux); err != nil {
+		logger.Fatal(err)
+	}
+
+	cancel()
+	app.wg.Wait()
+	logger.Info("background jobs stopped")
 }
\ No newline at end of file
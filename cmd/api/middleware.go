@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/balebbae/sodia/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	authUserCtx userKey = "authUser"
+	authSessionCtx userKey = "authSession"
+)
+
+func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("authorization header is missing"))
+			return
+		}
+
+		parts := strings.Split(authHeader, " ") // authorization: Bearer <token>
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("authorization header is malformed"))
+			return
+		}
+
+		jwtToken, err := app.authenticator.ValidateToken(parts[1])
+		if err != nil {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+
+		claims, _ := jwtToken.Claims.(jwt.MapClaims)
+
+		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+		if err != nil {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		user, err := app.store.Users.GetByID(ctx, userID)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.unauthorizedErrorResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if err := checkAccountStatus(user); err != nil {
+			app.inactiveAccountResponse(w, r, err)
+			return
+		}
+
+		// a token without a session couldn't be revoked
+		sessionID, _ := claims["sid"].(float64)
+		if sessionID == 0 {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("token is not bound to a session"))
+			return
+		}
+
+		if err := app.store.Sessions.Validate(ctx, int64(sessionID), user.ID); err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.unauthorizedErrorResponse(w, r, fmt.Errorf("session has been revoked or has expired"))
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, authUserCtx, user)
+		ctx = context.WithValue(ctx, authSessionCtx, int64(sessionID))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getAuthUserFromContext(r *http.Request) *store.User {
+	user, _ := r.Context().Value(authUserCtx).(*store.User)
+	return user
+}
+
+func getAuthSessionIDFromContext(r *http.Request) int64 {
+	sessionID, _ := r.Context().Value(authSessionCtx).(int64)
+	return sessionID
+}
+
+// checkPostOwnership lets the author of the post through, as well as anyone
+// whose role is at least requiredRole. An empty requiredRole restricts the
+// route to the author only.
+func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		post := getPostFromCtx(r)
+
+		if post.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.checkRole(requiredRole, next).ServeHTTP(w, r)
+	}
+}
+
+// checkCommentOwnership is the checkPostOwnership equivalent for comments.
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		comment := getCommentFromCtx(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.checkRole(requiredRole, next).ServeHTTP(w, r)
+	}
+}
+
+func (app *application) checkRole(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
+	if roleName == "" {
+		return false, nil
+	}
+
+	role, err := app.store.Roles.GetByName(ctx, roleName)
+	if err != nil {
+		return false, err
+	}
+
+	return user.Role.Level >= role.Level, nil
+}
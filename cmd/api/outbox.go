@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"math"
+	"time"
+
+	"github.com/balebbae/sodia/internal/mailer"
+)
+
+var (
+	outboxSent = expvar.NewInt("email_outbox_sent")
+	outboxFailed = expvar.NewInt("email_outbox_failed")
+	outboxDeadLettered = expvar.NewInt("email_outbox_dead_lettered")
+)
+
+// runEmailOutbox drains the email outbox until ctx is cancelled. Emails that
+// fail are retried with exponential backoff and dead-lettered after
+// maxAttempts.
+func (app *application) runEmailOutbox(ctx context.Context) {
+	ticker := time.NewTicker(app.config.outbox.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.drainEmailOutbox(ctx)
+		}
+	}
+}
+
+func (app *application) drainEmailOutbox(ctx context.Context) {
+	emails, err := app.store.Outbox.Claim(ctx, app.config.outbox.batchSize, app.config.outbox.lease)
+	if err != nil {
+		app.logger.Errorw("error claiming outbox emails", "error", err)
+		return
+	}
+
+	isProdEnv := app.config.env == "production"
+
+	for _, email := range emails {
+		if ctx.Err() != nil {
+			// the lease expires and another worker picks it up
+			return
+		}
+
+		err := app.mailer.Send(ctx, &mailer.Message{
+			Template: email.Template,
+			Data: email.Data,
+			To: []mailer.Address{{Name: email.Username, Email: email.Email}},
+			Sandbox: !isProdEnv,
+		})
+		if err == nil {
+			outboxSent.Add(1)
+			if err := app.store.Outbox.MarkSent(ctx, email.ID); err != nil {
+				app.logger.Errorw("error marking outbox email as sent", "id", email.ID, "error", err)
+			}
+			continue
+		}
+
+		attempts := email.Attempts + 1
+		dead := attempts >= app.config.outbox.maxAttempts
+		nextAttempt := time.Now().Add(app.outboxBackoff(attempts))
+
+		if dead {
+			outboxDeadLettered.Add(1)
+			app.logger.Errorw("outbox email dead-lettered", "id", email.ID, "template", email.Template, "attempts", attempts, "error", err)
+		} else {
+			outboxFailed.Add(1)
+			app.logger.Warnw("error sending outbox email", "id", email.ID, "template", email.Template, "attempts", attempts, "error", err)
+		}
+
+		if err := app.store.Outbox.MarkFailed(ctx, email.ID, err.Error(), nextAttempt, dead); err != nil {
+			app.logger.Errorw("error marking outbox email as failed", "id", email.ID, "error", err)
+		}
+	}
+}
+
+func (app *application) outboxBackoff(attempts int) time.Duration {
+	backoff := time.Duration(float64(app.config.outbox.baseBackoff) * math.Pow(2, float64(attempts-1)))
+	if backoff > app.config.outbox.maxBackoff {
+		return app.config.outbox.maxBackoff
+	}
+
+	return backoff
+}
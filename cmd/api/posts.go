@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/balebbae/sodia/internal/store"
 	"github.com/go-chi/chi/v5"
@@ -17,13 +21,17 @@ const postCtx postKey = "post"
 type CreatePostPayload struct {
 	Title string  `json:"title" validate:"required,max=100"` // validator 
 	Content string `json:"content" validate:"required,max=1000"`
-	Tags []string `json:"tags"`
+	// Tags are normalized before validation, see store.NormalizeTags
+	Tags []string `json:"tags" validate:"max=5,dive,max=30"`
+	// Status defaults to published, or scheduled when PublishAt is set
+	Status string `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 // CreatePost godoc
 //
 //	@Summary		Creates a post
-//	@Description	Creates a post
+//	@Description	Creates a post, published right away unless its status is draft, or scheduled with a publish_at in the future
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
@@ -41,22 +49,23 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return 
 	}
 
-	if err := Validate.Struct(payload); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+	user := getAuthUserFromContext(r)
+
+	post := &store.Post{
+		Title: payload.Title,
+		Content: payload.Content,
+		Tags: store.NormalizeTags(payload.Tags),
+		UserID: user.ID,
 	}
 
-	if payload.Content == "" {
-		app.badRequestResponse(w,r, fmt.Errorf("content is required"))
+	if err := validatePost(post); err != nil {
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	post := &store.Post{
-		Title: payload.Title,
-		Content: payload.Content,
-		Tags: payload.Tags,
-		// TODO: Change after auth
-		UserID: 156,
+	if err := schedulePost(post, payload.Status, payload.PublishAt); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
 	ctx := r.Context()
@@ -67,6 +76,10 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return 
 	}
 
+	if post.Status == store.PostStatusPublished {
+		app.fanOutPost(post)
+	}
+
 	if err = app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return 
@@ -76,14 +89,16 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 // GetPost godoc
 //
 //	@Summary		Fetches a post
-//	@Description	Fetches a post by ID
+//	@Description	Fetches a post by ID. The ETag of the response identifies the post as served, comments included; send it back as If-None-Match to get a 304 while it is unchanged.
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int	true	"Post ID"
-//	@Success		200	{object}	store.Post
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Param			id				path		int		true	"Post ID"
+//	@Param			If-None-Match	header		string	false	"ETag of the version already held"
+//	@Success		200				{object}	store.Post
+//	@Success		304				{string}	string	"Not modified"
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [get]
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -95,6 +110,10 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 		return 	
 	}
 
+	if notModified(w, r, postETag(post, comments)) {
+		return
+	}
+
 	// RICH DATA 
 	post.Comments = comments
 
@@ -107,12 +126,13 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 // DeletePost godoc
 //
 //	@Summary		Deletes a post
-//	@Description	Delete a post by ID
+//	@Description	Moves a post to the trash. It can be restored within the restore window and is purged after the retention period. Only the author or a moderator can delete a post.
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"Post ID"
 //	@Success		204	{object} string
+//	@Failure		403	{object}	error
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
 //	@Security		ApiKeyAuth
@@ -142,38 +162,213 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// mergePatchContentType is the media type of JSON Merge Patch (RFC 7396)
+// bodies.
+const mergePatchContentType = "application/merge-patch+json"
+
+// UpdatePostPayload changes the fields it sets. The post it results in is
+// validated like a new post, see validatePost.
 type UpdatePostPayload struct {
-	Title *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=100"`
+	Title *string `json:"title"`
+	Content *string `json:"content"`
+	Tags TagsPatch `json:"tags" swaggertype:"object"`
+	// Status moves a draft or scheduled post along. Published posts stay
+	// published.
+	Status *string `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// TagsPatch changes the tags of a post. As a JSON array it replaces them, and
+// null clears them. As an object it adds and removes tags:
+// {"add": ["go"], "remove": ["rust"]}.
+type TagsPatch struct {
+	Add []string `json:"add"`
+	Remove []string `json:"remove"`
+
+	present bool
+	replace bool
+	tags []string
+}
+
+func (p *TagsPatch) UnmarshalJSON(b []byte) error {
+	p.present = true
+
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		p.replace = true
+		return nil
+	case len(b) > 0 && b[0] == '[':
+		p.replace = true
+		return json.Unmarshal(b, &p.tags)
+	}
+
+	type ops TagsPatch
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode((*ops)(p))
+}
+
+// apply returns tags changed by the patch.
+func (p TagsPatch) apply(tags []string) []string {
+	if !p.present {
+		return tags
+	}
+
+	if p.replace {
+		return store.NormalizeTags(p.tags)
+	}
+
+	removed := make(map[string]bool, len(p.Remove))
+	for _, tag := range p.Remove {
+		removed[store.NormalizeTag(tag)] = true
+	}
+
+	var patched []string
+	for _, tag := range tags {
+		if !removed[tag] {
+			patched = append(patched, tag)
+		}
+	}
+
+	return store.NormalizeTags(append(patched, p.Add...))
+}
+
+// readUpdatePostPayload reads a PATCH body, plain JSON or a JSON Merge Patch.
+// In a merge patch null removes a field, which only tags can be, and tags
+// are replaced as a whole.
+func readUpdatePostPayload(w http.ResponseWriter, r *http.Request) (UpdatePostPayload, error) {
+	var payload UpdatePostPayload
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchContentType {
+		err := readJSON(w, r, &payload)
+		return payload, err
+	}
+
+	var patch map[string]json.RawMessage
+	if err := readJSON(w, r, &patch); err != nil {
+		return payload, err
+	}
+
+	for _, field := range []string{"title", "content", "status", "publish_at"} {
+		if v, ok := patch[field]; ok && bytes.Equal(bytes.TrimSpace(v), []byte("null")) {
+			return payload, fmt.Errorf("%s cannot be removed", field)
+		}
+	}
+
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return payload, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		return payload, err
+	}
+
+	if payload.Tags.present && !payload.Tags.replace {
+		return payload, errors.New("tags must be an array or null in a merge patch")
+	}
+
+	return payload, nil
+}
+
+// schedulePost sets the status of post, checking it is a known one and that
+// publish_at goes with it: it is required, and in the future, to schedule a
+// post and not allowed otherwise. An empty status keeps the current one, or
+// defaults to published.
+func schedulePost(post *store.Post, status string, publishAt *time.Time) error {
+	if status == "" {
+		switch {
+		case publishAt != nil:
+			status = store.PostStatusScheduled
+		case post.Status != "":
+			status = post.Status
+		default:
+			status = store.PostStatusPublished
+		}
+	}
+
+	switch status {
+	case store.PostStatusDraft, store.PostStatusScheduled, store.PostStatusPublished:
+	default:
+		return fmt.Errorf("unknown status %q", status)
+	}
+
+	if post.Status == store.PostStatusPublished && status != store.PostStatusPublished {
+		return errors.New("a published post cannot be unpublished")
+	}
+
+	switch {
+	case status == store.PostStatusScheduled && publishAt != nil:
+		if !publishAt.After(time.Now()) {
+			return errors.New("publish_at must be in the future")
+		}
+
+		at := publishAt.UTC().Format(time.RFC3339)
+		post.PublishAt = &at
+	case status == store.PostStatusScheduled:
+		if post.PublishAt == nil {
+			return errors.New("publish_at is required to schedule a post")
+		}
+	case publishAt != nil:
+		return errors.New("publish_at only applies to scheduled posts")
+	default:
+		post.PublishAt = nil
+	}
+
+	post.Status = status
+	return nil
+}
+
+// validatePost checks a post, new or updated, against the rules of
+// CreatePostPayload.
+func validatePost(post *store.Post) error {
+	return Validate.Struct(CreatePostPayload{
+		Title: post.Title,
+		Content: post.Content,
+		Tags: post.Tags,
+	})
 }
 
 // UpdatePost godoc
 //
 //	@Summary		Updates a post
-//	@Description	Updates a post by ID
+//	@Description	Updates a post by ID. Only the author can update a post. If-Match must carry the ETag the post was fetched with; when the post was edited or published since, nothing is updated and 412 is returned. New comments or a pin don't count. Tags are replaced by an array, or added and removed with {"add": [...], "remove": [...]}. The body can also be a JSON Merge Patch.
 //	@Tags			posts
-//	@Accept			json
+//	@Accept			json,application/merge-patch+json
 //	@Produce		json
-//	@Param			id		path		int					true	"Post ID"
-//	@Param			payload	body		UpdatePostPayload	true	"Post payload"
-//	@Success		200		{object}	store.Post
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		404		{object}	error
-//	@Failure		500		{object}	error
+//	@Param			id			path		int					true	"Post ID"
+//	@Param			If-Match	header		string				true	"ETag of the version being updated"
+//	@Param			payload		body		UpdatePostPayload	true	"Post payload"
+//	@Success		200			{object}	store.Post
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		412			{object}	error	"The post changed since the ETag was issued"
+//	@Failure		428			{object}	error	"If-Match is missing"
+//	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [patch]
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
-	var payload UpdatePostPayload
-	err := readJSON(w, r, &payload)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		app.preconditionRequiredResponse(w, r)
+		return
+	}
+
+	if !versionMatches(ifMatch, post.Version) {
+		app.preconditionFailedResponse(w, r, errVersionMismatch)
 		return
 	}
 
-	err = Validate.Struct(payload)
+	payload, err := readUpdatePostPayload(w, r)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -187,18 +382,129 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Title = *payload.Title
 	}
 
-	err = app.store.Posts.Update(r.Context(), post)
+	post.Tags = payload.Tags.apply(post.Tags)
+
+	if err := validatePost(post); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	status := ""
+	if payload.Status != nil {
+		status = *payload.Status
+	}
+
+	if err := schedulePost(post, status, payload.PublishAt); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	published, err := app.store.Posts.Update(r.Context(), post)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			// another update won the race since the post was read
+			app.preconditionFailedResponse(w, r, errVersionMismatch)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if published {
+		app.fanOutPost(post)
+	}
+
+	// the ETag covers the comments served with the post
+	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", postETag(post, comments))
+
 	err = app.jsonResponse(w, http.StatusOK, post)
 	if err != nil {
 		app.internalServerError(w, r, err) 
 	}
 }
 
+// PinPost godoc
+//
+//	@Summary		Pins a post
+//	@Description	Pins a published post to the top of its author's profile, replacing any post pinned before. Only the author can pin a post; drafts and scheduled posts can't be pinned.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		200	{object}	store.Post
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/pin [put]
+func (app *application) pinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	err := app.store.Posts.Pin(r.Context(), post)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict), errors.Is(err, store.ErrNotPublished):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UnpinPost godoc
+//
+//	@Summary		Unpins a post
+//	@Description	Unpins a post. Only the author can unpin a post.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		200	{object}	store.Post
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/pin [delete]
+func (app *application) unpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	if err := app.store.Posts.Unpin(r.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		idParam := chi.URLParam(r, "postID")
@@ -221,18 +527,36 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return 
 		}
 
+		// drafts and scheduled posts are only visible to their author
+		if post.Status != store.PostStatusPublished && post.UserID != getAuthUserFromContext(r).ID {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// fanOutPost copies a new post into its author's followers' timelines without
+// holding up the request.
+func (app *application) fanOutPost(post *store.Post) {
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := app.store.Timelines.FanOut(ctx, post); err != nil {
+			app.logger.Errorw("error fanning out post", "post_id", post.ID, "error", err)
+		}
+	})
+}
+
 func getPostFromCtx(r *http.Request) *store.Post {
 	post, _ := r.Context().Value(postCtx).(*store.Post)
 	return post
 }
 
 type CreateCommentPayload struct {
-	UserID int64 `json:"user_id" validate:"required"`
 	Content string 	`json:"content" validate:"required,max=1000"`
 }
 
@@ -254,9 +578,11 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
         return
     }
 
+    user := getAuthUserFromContext(r)
+
     comment := &store.Comment{
         PostID:  post.ID,
-        UserID:  payload.UserID,
+        UserID:  user.ID,
         Content: payload.Content,
     }
 
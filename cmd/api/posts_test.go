@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/balebbae/sodia/internal/store"
+)
+
+func TestCreatePostRejectsUnknownStatus(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	token := login(t, app, mux, "alice")
+
+	payload := map[string]any{"title": "hello", "content": "hello", "status": "bogus"}
+	if rr := do(t, mux, http.MethodPost, "/v1/posts", token, payload, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", rr.Code, http.StatusBadRequest, rr.Body)
+	}
+}
+
+func TestSchedulePostRejectsUnknownStatus(t *testing.T) {
+	post := &store.Post{}
+	if err := schedulePost(post, "bogus", nil); err == nil {
+		t.Fatalf("unknown status accepted, post is now %q", post.Status)
+	}
+}
+
+func TestReadUpdatePostPayloadMergePatch(t *testing.T) {
+	tests := []struct {
+		body string
+		wantErr bool
+	}{
+		{`{"title": "hello", "tags": ["go"]}`, false},
+		{`{"tags": null}`, false},
+		{`{"status": "published"}`, false},
+		{`{"title": null}`, true},
+		{`{"content": null}`, true},
+		{`{"status": null}`, true},
+		{`{"publish_at": null}`, true},
+		{`{"tags": {"add": ["go"]}}`, true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPatch, "/v1/posts/1", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", mergePatchContentType)
+
+		_, err := readUpdatePostPayload(httptest.NewRecorder(), r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.body, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/balebbae/sodia/internal/diff"
+	"github.com/balebbae/sodia/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// revisionDiff compares two versions of a post.
+type revisionDiff struct {
+	From int `json:"from"`
+	To int `json:"to"`
+	By string `json:"by"`
+	Title []diff.Op `json:"title"`
+	Content []diff.Op `json:"content"`
+}
+
+// GetPostRevisions godoc
+//
+//	@Summary		Fetches the revisions of a post
+//	@Description	Fetches the versions a post had before each of its edits, latest first.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		200	{object}	[]store.PostRevision
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions [get]
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	revisions, err := app.store.Revisions.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetPostRevision godoc
+//
+//	@Summary		Fetches a revision of a post
+//	@Description	Fetches a post as it was at a version. The current version is returned too, without replaced_at.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int	true	"Post ID"
+//	@Param			version	path		int	true	"Version"
+//	@Success		200		{object}	store.PostRevision
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions/{version} [get]
+func (app *application) getPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	revision, err := app.getRevision(r, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revision); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DiffPostRevisions godoc
+//
+//	@Summary		Compares two versions of a post
+//	@Description	Diffs the title and content of a post between a version and another one, the current version by default. Each diff is a list of equal, insert and delete runs of text.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int		true	"Post ID"
+//	@Param			version	path		int		true	"Version to compare from"
+//	@Param			to		query		int		false	"Version to compare to (default the current version)"
+//	@Param			by		query		string	false	"Granularity: line (default) or word"
+//	@Success		200		{object}	revisionDiff
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions/{version}/diff [get]
+func (app *application) diffPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	qs := r.URL.Query()
+	errs := store.FieldErrors{}
+
+	from, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		errs["version"] = "must be an integer"
+	}
+
+	to := post.Version
+	if v := qs.Get("to"); v != "" {
+		to, err = strconv.Atoi(v)
+		if err != nil {
+			errs["to"] = "must be an integer"
+		}
+	}
+
+	by := "line"
+	if v := qs.Get("by"); v != "" {
+		by = v
+	}
+	if by != "line" && by != "word" {
+		errs["by"] = "must be line or word"
+	}
+
+	if len(errs) > 0 {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+
+	var revisions [2]*store.PostRevision
+	for i, version := range []int{from, to} {
+		revisions[i], err = app.getRevision(r, version)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	compare := diff.Lines
+	if by == "word" {
+		compare = diff.Words
+	}
+
+	d := revisionDiff{
+		From: from,
+		To: to,
+		By: by,
+		Title: compare(revisions[0].Title, revisions[1].Title),
+		Content: compare(revisions[0].Content, revisions[1].Content),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, d); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getRevision returns the post in the request context as it was at version,
+// which may be its current version.
+func (app *application) getRevision(r *http.Request, version int) (*store.PostRevision, error) {
+	post := getPostFromCtx(r)
+
+	if version == post.Version {
+		return &store.PostRevision{
+			PostID: post.ID,
+			Version: post.Version,
+			Title: post.Title,
+			Content: post.Content,
+			Tags: post.Tags,
+		}, nil
+	}
+
+	return app.store.Revisions.Get(r.Context(), post.ID, version)
+}
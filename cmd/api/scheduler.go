@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runPostScheduler publishes scheduled posts as they come due, until ctx is
+// cancelled. Replicas running it side by side publish disjoint batches.
+func (app *application) runPostScheduler(ctx context.Context) {
+	ticker := time.NewTicker(app.config.scheduler.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.publishDuePosts(ctx)
+		}
+	}
+}
+
+// publishDuePosts publishes batches of due posts until none are left, then
+// fans them out like newly created posts.
+func (app *application) publishDuePosts(ctx context.Context) {
+	for ctx.Err() == nil {
+		posts, err := app.store.Posts.PublishDue(ctx, app.config.scheduler.batchSize)
+		if err != nil {
+			app.logger.Errorw("error publishing scheduled posts", "error", err)
+			return
+		}
+
+		for i := range posts {
+			app.fanOutPost(&posts[i])
+		}
+
+		if len(posts) > 0 {
+			app.logger.Infow("published scheduled posts", "count", len(posts))
+		}
+
+		if len(posts) < app.config.scheduler.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/balebbae/sodia/internal/store"
+)
+
+// searchPostsHandler godoc
+//
+//	@Summary		Searches posts
+//	@Description	Full-text search over the titles and contents of all posts, best matches first. q takes web search syntax: "quoted phrases", OR and -excluded words. Pages are walked with the next_cursor and prev_cursor of the response, also sent as Link headers.
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q			query		string	true	"Search terms"
+//	@Param			since		query		string	false	"Only posts created at or after this time (RFC 3339 or YYYY-MM-DD HH:MM:SS)"
+//	@Param			until		query		string	false	"Only posts created at or before this time (RFC 3339 or YYYY-MM-DD HH:MM:SS)"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Param			sort		query		string	false	"Sort"
+//	@Param			rank		query		string	false	"Ranking: search (default), latest, top or relevant"
+//	@Param			tags		query		string	false	"Tags"
+//	@Param			cursor		query		string	false	"Opaque cursor from next_cursor or prev_cursor"
+//	@Success		200			{object}	[]store.PostWithMetadata
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search/posts [get]
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+		Rank:   store.RankSearch,
+		Tags:   []string{},
+		Search: r.URL.Query().Get("q"),
+	}
+
+	if fq.Search == "" {
+		app.failedValidationResponse(w, r, map[string]string{"q": "must not be empty"})
+		return
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	posts, page, err := app.store.Posts.Search(r.Context(), fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// userSuggestion is what autocomplete returns for each match.
+type userSuggestion struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// searchUsersHandler godoc
+//
+//	@Summary		Searches users
+//	@Description	Finds active users whose username starts with or resembles q. Mutual follows come first, then the users you follow, then the closest matches. With autocomplete only the id and username of each match are returned.
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q				query		string	true	"Username or part of it"
+//	@Param			limit			query		int		false	"Limit"
+//	@Param			offset			query		int		false	"Offset"
+//	@Param			autocomplete	query		bool	false	"Return only id and username"
+//	@Success		200				{object}	[]store.UserSearchResult
+//	@Failure		400				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search/users [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	usq := store.UserSearchQuery{
+		Limit:  10,
+		Offset: 0,
+	}
+
+	usq, err := usq.Parse(r)
+	if err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(usq); err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+
+	users, err := app.store.Users.Search(r.Context(), user.ID, usq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if usq.Autocomplete {
+		suggestions := make([]userSuggestion, len(users))
+		for i, u := range users {
+			suggestions[i] = userSuggestion{ID: u.ID, Username: u.Username}
+		}
+
+		if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/balebbae/sodia/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetSessions godoc
+//
+//	@Summary		Lists active sessions
+//	@Description	Lists the devices currently signed in to the authenticated user's account
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	[]store.Session
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/sessions [get]
+func (app *application) getSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	sessions, err := app.store.Sessions.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	currentID := getAuthSessionIDFromContext(r)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, sessions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DeleteSession godoc
+//
+//	@Summary		Signs out a session
+//	@Description	Revokes a session so its refresh token can no longer be used
+//	@Tags			users
+//	@Produce		json
+//	@Param			sessionID	path		int		true	"Session ID"
+//	@Success		204			{string}	string	"Session revoked"
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/sessions/{sessionID} [delete]
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+
+	err = app.store.Sessions.Revoke(r.Context(), sessionID, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
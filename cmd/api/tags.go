@@ -0,0 +1,234 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/balebbae/sodia/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow = 7 * 24 * time.Hour
+	// maxTagLength matches the validation of post tags
+	maxTagLength = 30
+)
+
+// getTagPostsHandler godoc
+//
+//	@Summary		Fetches the posts with a tag
+//	@Description	Fetches the posts of everyone carrying the tag. Pages are walked with the next_cursor and prev_cursor of the response, also sent as Link headers.
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag		path		string	true	"Tag"
+//	@Param			since	query		string	false	"Only posts created at or after this time (RFC 3339 or YYYY-MM-DD HH:MM:SS)"
+//	@Param			until	query		string	false	"Only posts created at or before this time (RFC 3339 or YYYY-MM-DD HH:MM:SS)"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			rank	query		string	false	"Ranking: latest (default), top, relevant or search"
+//	@Param			search	query		string	false	"Full-text search terms in web search syntax"
+//	@Param			cursor	query		string	false	"Opaque cursor from next_cursor or prev_cursor"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/tags/{tag}/posts [get]
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+		Rank:   store.RankLatest,
+		Tags:   []string{},
+		Search: "",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	posts, page, err := app.store.Posts.GetByTag(r.Context(), tag, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// followTagHandler godoc
+//
+//	@Summary		Follows a tag
+//	@Description	Follows a tag, so posts carrying it show up in the feed
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		204	{object}	string	"Tag followed"
+//	@Failure		400	{object}	error
+//	@Failure		409	{object}	error	"Tag already followed"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/follow [put]
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+
+	err := app.store.Tags.Follow(r.Context(), user.ID, tag)
+	if err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictResponse(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// unfollowTagHandler godoc
+//
+//	@Summary		Unfollows a tag
+//	@Description	Unfollows a tag
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		204	{object}	string	"Tag unfollowed"
+//	@Failure		400	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/follow [delete]
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+
+	if err := app.store.Tags.Unfollow(r.Context(), user.ID, tag); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getTrendingTagsHandler godoc
+//
+//	@Summary		Fetches the trending tags
+//	@Description	Fetches the tags whose use grew the most over the last window compared to the window before it.
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Param			window	query		string	false	"Window as a duration, e.g. 6h (default 24h, at most 168h)"
+//	@Param			limit	query		int		false	"Limit (default 10, at most 50)"
+//	@Success		200		{object}	[]store.TrendingTag
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/tags/trending [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	errs := store.FieldErrors{}
+
+	window := defaultTrendingWindow
+	if v := qs.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		switch {
+		case err != nil:
+			errs["window"] = "must be a duration such as 6h"
+		case d < time.Hour || d > maxTrendingWindow:
+			errs["window"] = "must be between 1h and 168h"
+		}
+
+		window = d
+	}
+
+	limit := 10
+	if v := qs.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > 50 {
+			errs["limit"] = "must be an integer between 1 and 50"
+		}
+
+		limit = l
+	}
+
+	if len(errs) > 0 {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+
+	tags, err := app.store.Tags.Trending(r.Context(), window, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// readTag reads the normalized tag path parameter, writing the error response
+// and returning false when it isn't a valid tag.
+func (app *application) readTag(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tag := chi.URLParam(r, "tag")
+
+	// chi routes on the escaped path when the request has one, e.g. a tag
+	// with a slash in it
+	if r.URL.RawPath != "" {
+		unescaped, err := url.PathUnescape(tag)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return "", false
+		}
+
+		tag = unescaped
+	}
+
+	tag = store.NormalizeTag(tag)
+	switch {
+	case tag == "":
+		app.failedValidationResponse(w, r, map[string]string{"tag": "must not be empty"})
+		return "", false
+	case utf8.RuneCountInString(tag) > maxTagLength:
+		app.failedValidationResponse(w, r, map[string]string{"tag": "must be at most " + strconv.Itoa(maxTagLength) + " characters"})
+		return "", false
+	}
+
+	return tag, true
+}
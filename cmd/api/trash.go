@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/balebbae/sodia/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// RestorePost godoc
+//
+//	@Summary		Restores a deleted post
+//	@Description	Takes a deleted post out of the trash, with its comments, if it was deleted within the restore window. Only the author or a moderator can restore a post.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		200	{object}	store.Post
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error	"The restore window has passed"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/restore [post]
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	err := app.store.Posts.Restore(r.Context(), post.ID, app.config.trash.restoreWindow)
+	if err != nil {
+		app.restoreErrorResponse(w, r, err)
+		return
+	}
+
+	post.DeletedAt = nil
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// RestoreComment godoc
+//
+//	@Summary		Restores a deleted comment
+//	@Description	Takes a deleted comment out of the trash if it was deleted within the restore window. Only the author or a moderator can restore a comment.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Success		200			{object}	store.Comment
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"The restore window has passed"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/comments/{commentID}/restore [post]
+func (app *application) restoreCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	err := app.store.Comments.Restore(r.Context(), comment.ID, app.config.trash.restoreWindow)
+	if err != nil {
+		app.restoreErrorResponse(w, r, err)
+		return
+	}
+
+	comment.DeletedAt = nil
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) restoreErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundResponse(w, r, err)
+	case errors.Is(err, store.ErrRestoreExpired):
+		app.conflictResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// trashedPostContextMiddleware is postsContextMiddleware for deleted posts.
+func (app *application) trashedPostContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		post, err := app.store.Posts.GetTrashedByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, postCtx, post)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// trashedCommentContextMiddleware is commentsContextMiddleware for deleted
+// comments.
+func (app *application) trashedCommentContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		comment, err := app.store.Comments.GetTrashedByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		// the comment has to belong to the post in the URL
+		if post := getPostFromCtx(r); post == nil || post.ID != comment.PostID {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// purgeTrash periodically hard-deletes the posts and comments trashed longer
+// than the retention period, until ctx is cancelled.
+func (app *application) purgeTrash(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			posts, err := app.store.Posts.Purge(ctx, app.config.trash.retention)
+			if err != nil {
+				app.logger.Errorw("error purging trashed posts", "error", err)
+			}
+
+			comments, err := app.store.Comments.Purge(ctx, app.config.trash.retention)
+			if err != nil {
+				app.logger.Errorw("error purging trashed comments", "error", err)
+			}
+
+			if posts > 0 || comments > 0 {
+				app.logger.Infow("purged trash", "posts", posts, "comments", comments)
+			}
+		}
+	}
+}
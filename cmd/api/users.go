@@ -35,9 +35,123 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-type FollowUser struct {
-	UserID int64 `json:"user_id"`
+// GetUserPosts godoc
+//
+//	@Summary		Fetches a user's posts
+//	@Description	Fetches the posts of a user, their pinned post first. Pages are walked with the next_cursor and prev_cursor of the response, also sent as Link headers. The posts of suspended users are only visible to themselves.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			since	query		string	false	"Only posts created at or after this time (RFC 3339 or YYYY-MM-DD HH:MM:SS)"
+//	@Param			until	query		string	false	"Only posts created at or before this time (RFC 3339 or YYYY-MM-DD HH:MM:SS)"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			rank	query		string	false	"Ranking: latest (default), top, relevant or search"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Full-text search terms in web search syntax"
+//	@Param			cursor	query		string	false	"Opaque cursor from next_cursor or prev_cursor"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/posts [get]
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	viewer := getAuthUserFromContext(r)
+
+	if user.IsSuspended && user.ID != viewer.ID {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+		Rank:   store.RankLatest,
+		Tags:   []string{},
+		Search: "",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	posts, page, err := app.store.Posts.GetByUser(r.Context(), user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 }
+
+// GetDrafts godoc
+//
+//	@Summary		Fetches the user's drafts
+//	@Description	Fetches the draft and scheduled posts of the authenticated user. Pages are walked with the next_cursor and prev_cursor of the response, also sent as Link headers.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Full-text search terms in web search syntax"
+//	@Param			cursor	query		string	false	"Opaque cursor from next_cursor or prev_cursor"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/drafts [get]
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+		Rank:   store.RankLatest,
+		Tags:   []string{},
+		Search: "",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.validationErrorResponse(w, r, err)
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+
+	posts, page, err := app.store.Posts.GetDrafts(r.Context(), user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
 // FollowUser godoc
 // 
 //	@Summary		Follows a user 
@@ -49,37 +163,33 @@ type FollowUser struct {
 //	@Success		204		{object}	string	"User followed"
 //	@Failure		400		{object}	error	"User payload missing information"
 //	@Failure		404		{object}	error	"User not found"
+//	@Failure		409		{object}	error	"User already followed"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/follow [put]
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
-	// get id -> fetch users
-	followerUser := getUserFromContext(r)
+	followerUser := getAuthUserFromContext(r)
+	followedUser := getUserFromContext(r)
+
+	ctx := r.Context()
 
-	// TODO: revert back to auth userID from ctx
-	var payload FollowUser
-	if err := readJSON(w, r, &payload); err != nil {
-		app.badRequestResponse(w, r, err)
-		return 
+	followErr := app.store.Followers.Follow(ctx, followerUser.ID, followedUser.ID)
+	if followErr != nil && followErr != store.ErrConflict {
+		app.internalServerError(w, r, followErr)
+		return
 	}
 
-	ctx := r.Context()
-	// userID := ctx.Value("userID") // Retrieves a value set earlier in middleware
-    
-    // fmt.Fprintf(w, "User ID: %v", userID)
+	// following again retries the backfill, so don't swallow the error
+	if err := app.store.Timelines.Backfill(ctx, followerUser.ID, followedUser.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	err := app.store.Followers.Follow(ctx, followerUser.ID, payload.UserID)
-	if err != nil {
-		switch err {
-		case store.ErrConflict:
-			app.conflictResponse(w, r, err)
-			return 
-		default:
-			app.internalServerError(w, r, err)
-			return 
-		}
+	if followErr != nil {
+		app.conflictResponse(w, r, followErr)
+		return
 	}
 
-	err = app.jsonResponse(w, http.StatusNoContent, nil)
+	err := app.jsonResponse(w, http.StatusNoContent, nil)
 	if err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -99,23 +209,23 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/unfollow [put]
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	followerUser := getAuthUserFromContext(r)
 	unfollowedUser := getUserFromContext(r)
 
-
-	// TODO: revert back to auth userID from ctx
-	var payload FollowUser
-	if err := readJSON(w, r, &payload); err != nil {
-		app.badRequestResponse(w, r, err)
-	}
-
 	ctx := r.Context()
 
-	err := app.store.Followers.Unfollow(ctx, unfollowedUser.ID, payload.UserID)
+	err := app.store.Followers.Unfollow(ctx, followerUser.ID, unfollowedUser.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	// unfollowing again retries the prune, so don't swallow the error
+	if err := app.store.Timelines.Prune(ctx, followerUser.ID, unfollowedUser.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	err = app.jsonResponse(w, http.StatusNoContent, nil)
 	if err != nil {
 		app.internalServerError(w, r, err)
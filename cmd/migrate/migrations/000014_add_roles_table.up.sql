@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name varchar(255) UNIQUE NOT NULL,
+    level int NOT NULL DEFAULT 0,
+    description text
+);
+
+INSERT INTO
+    roles (name, description, level)
+VALUES
+    ('user', 'A user can create posts and comments', 1),
+    ('moderator', 'A moderator can delete other users posts and comments', 2),
+    ('admin', 'An admin can moderate posts and comments and manage users', 3);
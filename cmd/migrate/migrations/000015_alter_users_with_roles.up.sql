@@ -0,0 +1,14 @@
+ALTER TABLE
+    users
+ADD
+    COLUMN role_id bigint REFERENCES roles (id);
+
+UPDATE
+    users
+SET
+    role_id = (SELECT id FROM roles WHERE name = 'user');
+
+ALTER TABLE
+    users
+ALTER COLUMN
+    role_id SET NOT NULL;
@@ -0,0 +1,17 @@
+ALTER TABLE
+    users
+ADD
+    COLUMN is_suspended BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS user_status_changes (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    changed_by bigint,
+    is_suspended BOOLEAN NOT NULL,
+    reason text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (changed_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_status_changes_user_id ON user_status_changes (user_id);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS timelines (
+    user_id bigint NOT NULL,
+    post_id bigint NOT NULL,
+    author_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_timelines_user_id_created_at ON timelines (user_id, created_at DESC, post_id DESC);
+CREATE INDEX IF NOT EXISTS idx_timelines_user_id_author_id ON timelines (user_id, author_id);
+
+-- Materialize the timelines of existing follows
+INSERT INTO
+    timelines (user_id, post_id, author_id, created_at)
+SELECT
+    f.follower_id, p.id, p.user_id, p.created_at
+FROM
+    followers f
+    JOIN posts p ON p.user_id = f.user_id
+ON CONFLICT DO NOTHING;
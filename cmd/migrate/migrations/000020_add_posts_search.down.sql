@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_search;
+
+ALTER TABLE
+    posts DROP COLUMN search;
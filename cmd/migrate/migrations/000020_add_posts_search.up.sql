@@ -0,0 +1,10 @@
+-- Titles weigh more than content when ranking matches
+ALTER TABLE
+    posts
+ADD
+    COLUMN search tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING gin (search);
@@ -0,0 +1,2 @@
+-- Fuzzy and prefix username search; pg_trgm is enabled by 000008
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
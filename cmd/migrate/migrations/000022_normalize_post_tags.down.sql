@@ -0,0 +1,2 @@
+-- The original spelling of tags can't be restored
+DROP INDEX IF EXISTS idx_posts_created_at;
@@ -0,0 +1,27 @@
+-- Case-fold, trim and dedupe existing tags the way the API now does
+UPDATE
+    posts
+SET
+    tags = ARRAY(
+        SELECT
+            tag
+        FROM
+            (
+                SELECT
+                    lower(regexp_replace(btrim(t), '\s+', ' ', 'g')) AS tag,
+                    MIN(ord) AS ord
+                FROM
+                    unnest(tags) WITH ORDINALITY AS u(t, ord)
+                WHERE
+                    btrim(t) <> ''
+                GROUP BY
+                    1
+            ) normalized
+        ORDER BY
+            ord
+    )::varchar(100)[]
+WHERE
+    tags IS NOT NULL;
+
+-- Trending tags scan the posts of a recent window
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_user_id_pinned;
+
+ALTER TABLE
+    posts DROP COLUMN pinned_at;
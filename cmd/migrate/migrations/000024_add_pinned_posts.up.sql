@@ -0,0 +1,7 @@
+ALTER TABLE
+    posts
+ADD
+    COLUMN pinned_at timestamp(0) with time zone;
+
+-- A user pins at most one post
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_user_id_pinned ON posts (user_id) WHERE pinned_at IS NOT NULL;
@@ -0,0 +1,11 @@
+-- The versions of a post before each edit
+CREATE TABLE IF NOT EXISTS post_revisions (
+    post_id bigint NOT NULL,
+    version INT NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    tags VARCHAR(100) [],
+    replaced_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, version),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+ALTER TABLE
+    comments DROP CONSTRAINT IF EXISTS fk_comments_user;
+
+ALTER TABLE
+    comments DROP CONSTRAINT IF EXISTS fk_comments_post;
+
+DROP INDEX IF EXISTS idx_comments_deleted_at;
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+
+ALTER TABLE
+    comments DROP COLUMN deleted_at;
+
+ALTER TABLE
+    posts DROP COLUMN deleted_at;
@@ -0,0 +1,41 @@
+ALTER TABLE
+    posts
+ADD
+    COLUMN deleted_at timestamp(0) with time zone;
+
+ALTER TABLE
+    comments
+ADD
+    COLUMN deleted_at timestamp(0) with time zone;
+
+-- The purge job looks for trashed rows past retention
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Comments left behind by deleted posts and users
+DELETE FROM
+    comments c
+WHERE
+    NOT EXISTS (SELECT 1 FROM posts p WHERE p.id = c.post_id)
+    OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = c.user_id);
+
+-- post_id and user_id were created as bigserial, but reference other tables
+ALTER TABLE
+    comments
+ALTER COLUMN
+    post_id DROP DEFAULT,
+ALTER COLUMN
+    user_id DROP DEFAULT;
+
+DROP SEQUENCE IF EXISTS comments_post_id_seq;
+DROP SEQUENCE IF EXISTS comments_user_id_seq;
+
+ALTER TABLE
+    comments
+ADD
+    CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE;
+
+ALTER TABLE
+    comments
+ADD
+    CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_posts_publish_at;
+
+ALTER TABLE
+    posts DROP COLUMN publish_at;
+
+ALTER TABLE
+    posts DROP COLUMN status;
@@ -0,0 +1 @@
+-- Scrubbed template data can't be restored
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN is_celebrity boolean NOT NULL DEFAULT false;
+
+-- Authors at the default TIMELINE_FAN_OUT_LIMIT were not fanned out to
+UPDATE users u SET is_celebrity = true
+WHERE (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id) >= 10000;
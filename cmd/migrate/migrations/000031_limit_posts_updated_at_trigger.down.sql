@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS posts_set_updated_at ON posts;
+
+CREATE TRIGGER posts_set_updated_at BEFORE UPDATE ON posts FOR EACH ROW EXECUTE FUNCTION set_updated_at();
@@ -0,0 +1,11 @@
+-- Only edits of what a post says move updated_at, not deleting, restoring or pinning it
+DROP TRIGGER IF EXISTS posts_set_updated_at ON posts;
+
+CREATE TRIGGER posts_set_updated_at BEFORE UPDATE OF title, content, tags, status ON posts FOR EACH ROW
+WHEN (
+    OLD.title IS DISTINCT FROM NEW.title
+    OR OLD.content IS DISTINCT FROM NEW.content
+    OR OLD.tags IS DISTINCT FROM NEW.tags
+    OR OLD.status IS DISTINCT FROM NEW.status
+)
+EXECUTE FUNCTION set_updated_at();
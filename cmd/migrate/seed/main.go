@@ -19,7 +19,7 @@ func main() {
 
 	defer conn.Close()
 
-	store := store.NewStorage(conn)
+	store := store.NewStorage(conn, store.Config{})
 
 	db.Seed(store, conn)
 }
\ No newline at end of file
@@ -6,6 +6,7 @@ require github.com/go-chi/chi/v5 v5.2.0
 
 require (
 	github.com/go-playground/validator/v10 v10.24.0
+	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/lib/pq v1.10.9
 	github.com/swaggo/http-swagger v1.3.4
 	golang.org/x/net v0.37.0
@@ -29,10 +30,10 @@ require (
 	github.com/mailru/easyjson v0.9.0 // indirect
 	github.com/sendgrid/sendgrid-go v3.16.0+incompatible
 	github.com/swaggo/files v1.0.1 // indirect
-	github.com/swaggo/swag v1.16.4 // indirect
+	github.com/swaggo/swag v1.16.4
 	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
-	golang.org/x/crypto v0.36.0 // indirect
+	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.36.0
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	golang.org/x/tools v0.31.0 // indirect
@@ -0,0 +1,94 @@
+// Package dbtest hands tests a throwaway schema with every migration applied.
+// Tests using it are skipped unless TEST_DB_ADDR points to a Postgres database,
+// e.g. the one from docker-compose.
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// New creates a fresh schema, runs the up migrations into it and returns a
+// connection pool scoped to it. The schema is dropped when the test ends.
+func New(t *testing.T) *sql.DB {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR is not set")
+	}
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every pooled connection resolves unqualified names in the test schema,
+	// falling back to public for extensions that are already installed there
+	params := u.Query()
+	params.Set("search_path", schema+",public")
+	u.RawQuery = params.Encode()
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("error dropping test schema: %v", err)
+		}
+		admin.Close()
+	})
+
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func migrate(db *sql.DB) error {
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "..", "..", "cmd", "migrate", "migrations")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+
+		if _, err := db.Exec(string(content)); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(f), err)
+		}
+	}
+
+	return nil
+}
@@ -141,6 +141,11 @@ func generateUsers(num int) []*store.User {
 		users[i] = &store.User{
 			Username: usernames[i%len(usernames)] + fmt.Sprintf("%d", i),
 			Email: usernames[i%len(usernames)] + fmt.Sprintf("%d", i) + "@example.com",
+			IsActive: true,
+		}
+
+		if err := users[i].Password.Set("123123"); err != nil {
+			log.Fatal(err)
 		}
 	}
 
@@ -156,15 +161,22 @@ func generatePosts(num int, users []*store.User) []*store.Post {
 			UserID: user.ID,
 			Title: titles[rand.Intn(len(titles))],
 			Content: titles[rand.Intn(len(content))],
-			Tags: []string{
-				tags[rand.Intn(len(tags))],
-				tags[rand.Intn(len(tags))],
-			},
+			Tags: store.NormalizeTags(randomTags(2)),
 		}
 	}
 	return posts
 }
 
+// randomTags picks n distinct tags.
+func randomTags(n int) []string {
+	picked := make([]string, n)
+	for i, j := range rand.Perm(len(tags))[:n] {
+		picked[i] = tags[j]
+	}
+
+	return picked
+}
+
 func generateComments(num int, users []*store.User, posts []*store.Post) []*store.Comment {
 	cms := make([]*store.Comment, num)
 	for i := 0; i < num; i++ {
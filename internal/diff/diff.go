@@ -0,0 +1,88 @@
+// Package diff compares two texts line by line or word by word.
+package diff
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	OpEqual = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Op is a run of text that is the same in both texts, or only in the new one
+// (insert) or the old one (delete). Joining the equal and delete runs gives
+// the old text back, joining the equal and insert runs the new one.
+type Op struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+var wordRegex = regexp.MustCompile(`\s+|[^\s]+`)
+
+// Lines diffs a and b line by line.
+func Lines(a, b string) []Op {
+	return compare(strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n"))
+}
+
+// Words diffs a and b word by word, whitespace runs counting as words.
+func Words(a, b string) []Op {
+	return compare(wordRegex.FindAllString(a, -1), wordRegex.FindAllString(b, -1))
+}
+
+// compare walks the longest common subsequence of the tokens of a and b.
+// Posts are short, so the quadratic table is fine.
+func compare(a, b []string) []Op {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []Op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = appendOp(ops, OpEqual, a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = appendOp(ops, OpDelete, a[i])
+			i++
+		default:
+			ops = appendOp(ops, OpInsert, b[j])
+			j++
+		}
+	}
+
+	return ops
+}
+
+// appendOp adds text to ops, merging it into the last run when it has the
+// same type.
+func appendOp(ops []Op, typ, text string) []Op {
+	if text == "" {
+		return ops
+	}
+
+	if n := len(ops); n > 0 && ops[n-1].Type == typ {
+		ops[n-1].Text += text
+		return ops
+	}
+
+	return append(ops, Op{Type: typ, Text: text})
+}
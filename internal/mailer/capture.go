@@ -0,0 +1,137 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var linkRegex = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"`)
+
+type CapturedMessage struct {
+	ID int64 `json:"id"`
+	Template string `json:"template"`
+	To []Address `json:"to"`
+	Cc []Address `json:"cc"`
+	Subject string `json:"subject"`
+	Text string `json:"text"`
+	Links []string `json:"links"`
+	Attachments []string `json:"attachments"`
+	File string `json:"file,omitempty"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// Inbox is implemented by mailers that keep what they "sent" around for
+// inspection.
+type Inbox interface {
+	Messages() []CapturedMessage
+}
+
+// CaptureMailer never delivers anything. It keeps the last messages in memory
+// and, when dir is set, also writes each one as an .eml file that any mail
+// client can open.
+type CaptureMailer struct {
+	mu sync.Mutex
+	dir string
+	fromEmail string
+	size int
+	templates *Templates
+	nextID int64
+	messages []CapturedMessage
+}
+
+func NewCapture(dir string, size int, fromEmail string, templates *Templates) (*CaptureMailer, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("capture size must be positive, got %d", size)
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &CaptureMailer{
+		dir: dir,
+		fromEmail: fromEmail,
+		size: size,
+		templates: templates,
+	}, nil
+}
+
+func (m *CaptureMailer) Send(ctx context.Context, msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	content, err := m.templates.render(msg.Template, msg.Data)
+	if err != nil {
+		return err
+	}
+
+	eml, err := buildMessage(Address{Name: FromName, Email: m.fromEmail}, msg, content)
+	if err != nil {
+		return err
+	}
+
+	attachments := make([]string, len(msg.Attachments))
+	for i, a := range msg.Attachments {
+		attachments[i] = a.Filename
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	captured := CapturedMessage{
+		ID: m.nextID,
+		Template: msg.Template,
+		To: msg.To,
+		Cc: msg.Cc,
+		Subject: content.subject,
+		Text: content.text,
+		Links: extractLinks(content.html),
+		Attachments: attachments,
+		SentAt: time.Now(),
+	}
+
+	if m.dir != "" {
+		captured.File = filepath.Join(m.dir, fmt.Sprintf("%s-%06d.eml", captured.SentAt.Format("20060102T150405"), captured.ID))
+		if err := os.WriteFile(captured.File, eml, 0o644); err != nil {
+			return err
+		}
+	}
+
+	if len(m.messages) == m.size {
+		m.messages = m.messages[1:]
+	}
+	m.messages = append(m.messages, captured)
+
+	return nil
+}
+
+// Messages returns the captured messages, newest first.
+func (m *CaptureMailer) Messages() []CapturedMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]CapturedMessage, len(m.messages))
+	for i, msg := range m.messages {
+		messages[len(m.messages)-1-i] = msg
+	}
+
+	return messages
+}
+
+func extractLinks(body string) []string {
+	links := []string{}
+	for _, m := range linkRegex.FindAllStringSubmatch(body, -1) {
+		links = append(links, m[1])
+	}
+
+	return links
+}
@@ -1,16 +1,95 @@
 package mailer
 
-import "embed"
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
 
 const (
 	FromName = "Sodia"
 	maxRetries = 3
 	UserWelcomeTemplate = "user_invitation.go.tmpl"
+	PasswordResetTemplate = "password_reset.go.tmpl"
 )
 
 //go:embed "template"
 var FS embed.FS
 
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandbox bool) error
-}
\ No newline at end of file
+	Send(ctx context.Context, msg *Message) error
+}
+
+type Address struct {
+	Name string `json:"name"`
+	Email string `json:"email"`
+}
+
+type Attachment struct {
+	Filename string
+	ContentType string
+	Data []byte
+}
+
+// Message is an email rendered from one of the embedded templates. Data is
+// passed to the template as is.
+type Message struct {
+	Template string
+	Data any
+	To []Address
+	Cc []Address
+	ReplyTo *Address
+	Headers map[string]string
+	Attachments []Attachment
+	// Sandbox asks the provider to validate the message without delivering it,
+	// where the provider supports it.
+	Sandbox bool
+}
+
+func (m *Message) validate() error {
+	if m.Template == "" {
+		return errors.New("message has no template")
+	}
+
+	if len(m.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+
+	for key, value := range m.Headers {
+		if strings.ContainsAny(key+value, "\r\n") {
+			return fmt.Errorf("invalid header %q", key)
+		}
+	}
+
+	return nil
+}
+
+// sendWithRetries calls send up to maxRetries times, backing off between
+// attempts. It gives up early when ctx is cancelled.
+func sendWithRetries(ctx context.Context, logger *zap.SugaredLogger, msg *Message, send func(context.Context) error) error {
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		if err = send(ctx); err == nil {
+			return nil
+		}
+
+		logger.Warnw("failed to send email", "template", msg.Template, "to", msg.To[0].Email, "attempt", i+1, "max_attempts", maxRetries, "error", err)
+
+		if i == maxRetries-1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second * time.Duration(i+1)):
+		}
+	}
+
+	return fmt.Errorf("failed to send email after %d attempts: %w", maxRetries, err)
+}
@@ -1,75 +1,98 @@
 package mailer
 
 import (
-	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
-	"html/template"
-	"log"
-	"time"
 
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"go.uber.org/zap"
 )
 
 type SendGridMailer struct {
 	fromEmail string
 	apiKey string
 	client *sendgrid.Client
+	templates *Templates
+	logger *zap.SugaredLogger
 }
 
-func NewSendGrid(apiKey, fromEmail string) *SendGridMailer {
+func NewSendGrid(apiKey, fromEmail string, templates *Templates, logger *zap.SugaredLogger) *SendGridMailer {
 	client := sendgrid.NewSendClient(apiKey)
 
 	return &SendGridMailer{
 		fromEmail: fromEmail,
 		apiKey: apiKey,
 		client: client,
+		templates: templates,
+		logger: logger,
 	}
 }
 
-func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
-	from := mail.NewEmail(FromName, m.fromEmail)
-	to := mail.NewEmail(username, email)
-
-	// Template parsing and building
-	tmpl, err := template.ParseFS(FS, "template/"+templateFile)
-	if err != nil {
+func (m *SendGridMailer) Send(ctx context.Context, msg *Message) error {
+	if err := msg.validate(); err != nil {
 		return err
 	}
 
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	content, err := m.templates.render(msg.Template, msg.Data)
 	if err != nil {
 		return err
 	}
 
-	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
-	if err != nil {
-		return err
+	message := mail.NewV3Mail()
+	message.SetFrom(mail.NewEmail(FromName, m.fromEmail))
+	message.Subject = content.subject
+
+	p := mail.NewPersonalization()
+	for _, to := range msg.To {
+		p.AddTos(mail.NewEmail(to.Name, to.Email))
+	}
+	for _, cc := range msg.Cc {
+		p.AddCCs(mail.NewEmail(cc.Name, cc.Email))
+	}
+	message.AddPersonalizations(p)
+
+	if msg.ReplyTo != nil {
+		message.SetReplyTo(mail.NewEmail(msg.ReplyTo.Name, msg.ReplyTo.Email))
 	}
 
-	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
+	for key, value := range msg.Headers {
+		message.SetHeader(key, value)
+	}
+
+	// SendGrid requires text/plain to come before text/html
+	message.AddContent(
+		mail.NewContent("text/plain", content.text),
+		mail.NewContent("text/html", content.html),
+	)
+
+	for _, a := range msg.Attachments {
+		attachment := mail.NewAttachment().
+			SetFilename(a.Filename).
+			SetType(a.ContentType).
+			SetDisposition("attachment").
+			SetContent(base64.StdEncoding.EncodeToString(a.Data))
+		message.AddAttachment(attachment)
+	}
 
 	message.SetMailSettings(&mail.MailSettings{
 		SandboxMode: &mail.Setting{
-			Enable: &isSandbox,
+			Enable: &msg.Sandbox,
 		},
 	})
 
-	for i := 0; i < maxRetries; i++ {
-		response, err := m.client.Send(message)
+	return sendWithRetries(ctx, m.logger, msg, func(ctx context.Context) error {
+		response, err := m.client.SendWithContext(ctx, message)
 		if err != nil {
-			log.Printf("Failed to send email to %v, attemp %d of %d", email, i+1, maxRetries)
-			log.Printf("Error: %v", err.Error())
+			return err
+		}
 
-			time.Sleep(time.Second * time.Duration(i+1))
-			continue
+		if response.StatusCode >= 300 {
+			return fmt.Errorf("sendgrid responded with status code %d: %s", response.StatusCode, response.Body)
 		}
 
-		log.Printf("Email sent with status code %v", response.StatusCode)
+		m.logger.Infow("email sent", "template", msg.Template, "provider", "sendgrid", "status", response.StatusCode)
 		return nil
-	}
-
-	return fmt.Errorf("failed to send email after %d attempts", maxRetries)
-}
\ No newline at end of file
+	})
+}
@@ -0,0 +1,350 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	TLSModeNone = "none"
+	TLSModeStartTLS = "starttls"
+	TLSModeImplicit = "tls"
+
+	AuthPlain = "plain"
+	AuthLogin = "login"
+)
+
+type SMTPConfig struct {
+	Host string
+	Port int
+	Username string
+	Password string
+	TLSMode string
+	AuthMethod string
+}
+
+type SMTPMailer struct {
+	fromEmail string
+	cfg SMTPConfig
+	templates *Templates
+	logger *zap.SugaredLogger
+}
+
+func NewSMTP(cfg SMTPConfig, fromEmail string, templates *Templates, logger *zap.SugaredLogger) (*SMTPMailer, error) {
+	switch cfg.TLSMode {
+	case TLSModeNone, TLSModeStartTLS, TLSModeImplicit:
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode %q", cfg.TLSMode)
+	}
+
+	switch cfg.AuthMethod {
+	case AuthPlain, AuthLogin:
+	default:
+		return nil, fmt.Errorf("unknown smtp auth method %q", cfg.AuthMethod)
+	}
+
+	return &SMTPMailer{
+		fromEmail: fromEmail,
+		cfg: cfg,
+		templates: templates,
+		logger: logger,
+	}, nil
+}
+
+// Send renders the template and delivers it over SMTP. SMTP has no sandbox
+// mode, so msg.Sandbox is ignored: point development at a local catcher such
+// as MailHog instead.
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	content, err := m.templates.render(msg.Template, msg.Data)
+	if err != nil {
+		return err
+	}
+
+	message, err := buildMessage(Address{Name: FromName, Email: m.fromEmail}, msg, content)
+	if err != nil {
+		return err
+	}
+
+	recipients := make([]string, 0, len(msg.To)+len(msg.Cc))
+	for _, a := range append(msg.To, msg.Cc...) {
+		recipients = append(recipients, a.Email)
+	}
+
+	return sendWithRetries(ctx, m.logger, msg, func(ctx context.Context) error {
+		if err := m.deliver(ctx, m.fromEmail, recipients, message); err != nil {
+			return err
+		}
+
+		m.logger.Infow("email sent", "template", msg.Template, "provider", "smtp")
+		return nil
+	})
+}
+
+func (m *SMTPMailer) deliver(ctx context.Context, from string, to []string, message []byte) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.TLSMode == TLSModeImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// net/smtp isn't context aware, so bound the whole exchange instead
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.cfg.TLSMode == TLSModeStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if m.cfg.Username != "" {
+		if err := c.Auth(m.auth()); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func (m *SMTPMailer) auth() smtp.Auth {
+	if m.cfg.AuthMethod == AuthLogin {
+		return &loginAuth{username: m.cfg.Username, password: m.cfg.Password}
+	}
+
+	return smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp doesn't ship but
+// some relays (Office 365 among them) still require.
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
+
+// buildMessage assembles a multipart/alternative message with a plain text
+// and an HTML part, wrapped in multipart/mixed when there are attachments.
+func buildMessage(from Address, msg *Message, content *rendered) ([]byte, error) {
+	alternative := new(bytes.Buffer)
+	aw := multipart.NewWriter(alternative)
+
+	for _, part := range []struct {
+		contentType string
+		content string
+	}{
+		{"text/plain; charset=UTF-8", content.text},
+		{"text/html; charset=UTF-8", content.html},
+	} {
+		w, err := aw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+
+	headers := []string{
+		"From: " + formatAddresses(from),
+		"To: " + formatAddresses(msg.To...),
+	}
+	if len(msg.Cc) > 0 {
+		headers = append(headers, "Cc: "+formatAddresses(msg.Cc...))
+	}
+	if msg.ReplyTo != nil {
+		headers = append(headers, "Reply-To: "+formatAddresses(*msg.ReplyTo))
+	}
+	for key, value := range msg.Headers {
+		headers = append(headers, key+": "+mime.QEncoding.Encode("utf-8", value))
+	}
+	headers = append(headers,
+		"Subject: "+mime.QEncoding.Encode("utf-8", content.subject),
+		"Date: "+time.Now().Format(time.RFC1123Z),
+		"Message-ID: "+messageID(from.Email),
+		"MIME-Version: 1.0",
+	)
+
+	out := new(bytes.Buffer)
+
+	if len(msg.Attachments) == 0 {
+		headers = append(headers, "Content-Type: multipart/alternative; boundary="+aw.Boundary())
+		out.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+		out.Write(alternative.Bytes())
+		return out.Bytes(), nil
+	}
+
+	mixed := new(bytes.Buffer)
+	mw := multipart.NewWriter(mixed)
+
+	w, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + aw.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(alternative.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, a := range msg.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			if _, err := w.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+				return nil, err
+			}
+			encoded = encoded[76:]
+		}
+
+		if _, err := w.Write([]byte(encoded)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	headers = append(headers, "Content-Type: multipart/mixed; boundary="+mw.Boundary())
+	out.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	out.Write(mixed.Bytes())
+
+	return out.Bytes(), nil
+}
+
+func formatAddresses(addresses ...Address) string {
+	formatted := make([]string, len(addresses))
+	for i, a := range addresses {
+		formatted[i] = (&mail.Address{Name: a.Name, Address: a.Email}).String()
+	}
+
+	return strings.Join(formatted, ", ")
+}
+
+func messageID(fromEmail string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(fromEmail, "@"); at != -1 {
+		domain = fromEmail[at+1:]
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return fmt.Sprintf("<%x@%s>", b, domain)
+}
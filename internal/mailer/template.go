@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// requiredBlocks must be defined by every template. subject and text are
+// rendered as plain text, body as HTML.
+var requiredBlocks = []string{"subject", "body", "text"}
+
+type templateSet struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Templates holds every embedded email template, parsed once.
+type Templates struct {
+	sets map[string]templateSet
+}
+
+type rendered struct {
+	subject string
+	html string
+	text string
+}
+
+// ParseTemplates parses and validates every template under template/ in fsys.
+// It fails if any template is missing one of the required blocks, so a broken
+// template is caught at startup rather than when the first email goes out.
+func ParseTemplates(fsys fs.FS) (*Templates, error) {
+	files, err := fs.Glob(fsys, "template/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{sets: make(map[string]templateSet, len(files))}
+	for _, file := range files {
+		html, err := htmltemplate.ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		text, err := texttemplate.ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range requiredBlocks {
+			if text.Lookup(block) == nil {
+				return nil, fmt.Errorf("template %s: missing %q block", file, block)
+			}
+		}
+
+		t.sets[path.Base(file)] = templateSet{html: html, text: text}
+	}
+
+	return t, nil
+}
+
+func (t *Templates) render(name string, data any) (*rendered, error) {
+	set, ok := t.sets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	subject := new(bytes.Buffer)
+	if err := set.text.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	body := new(bytes.Buffer)
+	if err := set.html.ExecuteTemplate(body, "body", data); err != nil {
+		return nil, err
+	}
+
+	text := new(bytes.Buffer)
+	if err := set.text.ExecuteTemplate(text, "text", data); err != nil {
+		return nil, err
+	}
+
+	return &rendered{
+		subject: strings.TrimSpace(subject.String()),
+		html: body.String(),
+		text: strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
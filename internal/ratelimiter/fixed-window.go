@@ -0,0 +1,66 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+type clientWindow struct {
+	count int
+	start time.Time
+}
+
+type FixedWindowRateLimiter struct {
+	sync.Mutex
+	clients map[string]*clientWindow
+	limit int
+	window time.Duration
+	lastSweep time.Time
+}
+
+func NewFixedWindowLimiter(limit int, window time.Duration) *FixedWindowRateLimiter {
+	return &FixedWindowRateLimiter{
+		clients: make(map[string]*clientWindow),
+		limit: limit,
+		window: window,
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether another request for key fits in the current window.
+// When it doesn't, the returned duration is how long until the window resets.
+func (rl *FixedWindowRateLimiter) Allow(key string) (bool, time.Duration) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := time.Now()
+	rl.sweep(now)
+
+	w, exists := rl.clients[key]
+	if !exists || now.Sub(w.start) >= rl.window {
+		w = &clientWindow{start: now}
+		rl.clients[key] = w
+	}
+
+	if w.count >= rl.limit {
+		return false, w.start.Add(rl.window).Sub(now)
+	}
+
+	w.count++
+	return true, 0
+}
+
+// sweep drops expired windows at most once per window so keys that are never
+// seen again don't pile up.
+func (rl *FixedWindowRateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.window {
+		return
+	}
+
+	for key, w := range rl.clients {
+		if now.Sub(w.start) >= rl.window {
+			delete(rl.clients, key)
+		}
+	}
+	rl.lastSweep = now
+}
@@ -0,0 +1,7 @@
+package ratelimiter
+
+import "time"
+
+type Limiter interface {
+	Allow(key string) (bool, time.Duration)
+}
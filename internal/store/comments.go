@@ -2,6 +2,8 @@ package store
 
 import (
 	"database/sql"
+	"errors"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -12,6 +14,7 @@ type Comment struct {
 	UserID int64 `json:"user_id"`
 	Content string `json:"content"`
 	CreatedAt string `json:"created_at"`
+	DeletedAt *string `json:"deleted_at,omitempty"`
 	User User`json:"user"`
 }
 
@@ -24,7 +27,7 @@ func (s *CommentStore) GetByPostID (ctx context.Context, postID int64) ([]Commen
 		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username, u.id 
 		FROM comments c
 		JOIN users u on u.id = c.user_id
-		WHERE c.post_id = $1
+		WHERE c.post_id = $1 AND c.deleted_at IS NULL
 		ORDER BY c.created_at DESC;
 	`
 
@@ -76,4 +79,84 @@ func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (s *CommentStore) GetByID(ctx context.Context, id int64) (*Comment, error) {
+	return s.getByID(ctx, id, false)
+}
+
+// GetTrashedByID returns a deleted comment that hasn't been purged yet.
+func (s *CommentStore) GetTrashedByID(ctx context.Context, id int64) (*Comment, error) {
+	return s.getByID(ctx, id, true)
+}
+
+func (s *CommentStore) getByID(ctx context.Context, id int64, trashed bool) (*Comment, error) {
+	query := `
+		SELECT id, post_id, user_id, content, created_at, deleted_at
+		FROM comments
+		WHERE id = $1 AND (deleted_at IS NOT NULL) = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var comment Comment
+	err := s.db.QueryRowContext(ctx, query, id, trashed).Scan(
+		&comment.ID,
+		&comment.PostID,
+		&comment.UserID,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.DeletedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &comment, nil
+}
+
+// Delete moves a comment to the trash, like PostStore.Delete.
+func (s *CommentStore) Delete(ctx context.Context, id int64) error {
+	query := `UPDATE comments SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Restore takes a comment out of the trash if it was deleted within window.
+func (s *CommentStore) Restore(ctx context.Context, id int64, window time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return restore(ctx, s.db, "comments", id, window)
+}
+
+// Purge permanently deletes the comments trashed longer than retention ago.
+func (s *CommentStore) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return purge(ctx, s.db, "comments", retention)
+}
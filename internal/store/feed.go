@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// feedQuery collects the arguments of a feed query while it is built, so the
+// pieces contributed by filters and scorers can each add their own.
+type feedQuery struct {
+	args []any
+	userID int64
+	// at is the instant time-decayed scores are computed for. It is carried
+	// in the cursor so every page of a feed is ranked the same way.
+	at time.Time
+	// tsquery is the parsed search terms, empty when not searching.
+	tsquery string
+	// unpublished lists draft and scheduled posts instead of published ones.
+	unpublished bool
+}
+
+func newFeedQuery(userID int64, fq PaginatedFeedQuery) *feedQuery {
+	q := &feedQuery{userID: userID, at: time.Now()}
+
+	if fq.Search != "" {
+		q.tsquery = "websearch_to_tsquery('english', " + q.arg(fq.Search) + ")"
+	}
+
+	if fq.cursor != nil && fq.cursor.At != "" {
+		if at, err := time.Parse(time.RFC3339Nano, fq.cursor.At); err == nil {
+			q.at = at
+		}
+	}
+
+	return q
+}
+
+// arg adds v to the query arguments and returns its placeholder.
+func (q *feedQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// Search matches are delimited with private use characters rather than
+// markup, so the snippet can be HTML-escaped before they become <mark> tags.
+// They are stripped from the content first so posts can't forge them.
+const (
+	highlightStart = "\uE000"
+	highlightStop = "\uE001"
+)
+
+// headlineOptions shape the search snippets: a couple of short fragments
+// around the matches.
+const headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxWords=35, MinWords=15, MaxFragments=2"
+
+// highlightSnippet escapes a snippet from ts_headline and wraps its matches
+// in <mark>.
+func highlightSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, highlightStart, "<mark>")
+	return strings.ReplaceAll(s, highlightStop, "</mark>")
+}
+
+// listPosts returns a page of the posts selected by source, a query yielding
+// post_id and reason columns, filtered and ordered as fq asks.
+func (s *PostStore) listPosts(ctx context.Context, q *feedQuery, source string, fq PaginatedFeedQuery) ([]PostWithMetadata, Page, error) {
+	scorer, ok := feedScorers[fq.Rank]
+	if !ok {
+		scorer = feedScorers[RankLatest]
+	}
+
+	order, cmp := "DESC", "<"
+	if fq.Sort == "asc" {
+		order, cmp = "ASC", ">"
+	}
+
+	// walking backwards reads the items before the cursor in reverse order
+	backward := fq.cursor != nil && fq.cursor.Prev
+	if backward {
+		order, cmp = reverseOrder(order)
+	}
+
+	filters := " AND p.status = '" + PostStatusPublished + "'"
+	if q.unpublished {
+		filters = " AND p.status <> '" + PostStatusPublished + "'"
+	}
+
+	snippet := "''"
+	if q.tsquery != "" {
+		filters += " AND p.search @@ " + q.tsquery
+		snippet = fmt.Sprintf(
+			"ts_headline('english', translate(pg.content, %s, ''), %s, %s)",
+			q.arg(highlightStart+highlightStop),
+			q.tsquery,
+			q.arg(headlineOptions),
+		)
+	}
+	if len(fq.Tags) > 0 {
+		filters += " AND p.tags @> " + q.arg(pq.Array(fq.Tags))
+	}
+	if !fq.Since.IsZero() {
+		filters += " AND p.created_at >= " + q.arg(fq.Since)
+	}
+	if !fq.Until.IsZero() {
+		filters += " AND p.created_at <= " + q.arg(fq.Until)
+	}
+
+	with := scorer.with(q)
+	score := scorer.score(q)
+
+	keyset := ""
+	if fq.cursor != nil {
+		keyset = fmt.Sprintf("WHERE (score, id) %s (%s::%s, %s)", cmp, q.arg(fq.cursor.Key), scorer.keyType(), q.arg(fq.cursor.ID))
+	}
+
+	// one extra row tells us whether there is another page
+	limit := q.arg(fq.Limit + 1)
+	offset := q.arg(fq.Offset)
+
+	query := `
+		WITH feed AS (
+			` + source + `
+		),
+		base AS (
+			SELECT
+				p.id,
+				p.user_id,
+				p.title,
+				p.content,
+				p.created_at,
+				p.version,
+				p.tags,
+				p.status,
+				p.publish_at,
+				p.search,
+				u.username,
+				feed.reason,
+				` + editedColumn("p") + ` AS edited,
+				(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comments_count
+			FROM posts p
+			JOIN feed ON feed.post_id = p.id
+			JOIN users u ON u.id = p.user_id
+			WHERE p.deleted_at IS NULL` + filters + `
+		)` + with + `,
+		ranked AS (
+			SELECT b.*, ` + score + ` AS score FROM base b
+		)
+		SELECT
+			pg.id, pg.user_id, pg.title, pg.content, pg.created_at, pg.version, pg.tags,
+			pg.status, pg.publish_at, pg.edited, pg.username, pg.comments_count, pg.reason, pg.score, ` + snippet + `
+		FROM (
+			SELECT * FROM ranked
+			` + keyset + `
+			ORDER BY score ` + order + `, id ` + order + `
+			LIMIT ` + limit + ` OFFSET ` + offset + `
+		) pg
+		ORDER BY pg.score ` + order + `, pg.id ` + order
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	defer rows.Close()
+
+	type scoredPost struct {
+		post PostWithMetadata
+		key string
+	}
+
+	var scored []scoredPost
+	for rows.Next() {
+		var sp scoredPost
+		p := &sp.post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.PublishAt,
+			&p.Edited,
+			&p.User.Username,
+			&p.CommentsCount,
+			&p.Reason,
+			&sp.key,
+			&p.Snippet,
+		)
+		if err != nil {
+			return nil, Page{}, err
+		}
+
+		p.Snippet = highlightSnippet(p.Snippet)
+		scored = append(scored, sp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+
+	at := q.at.Format(time.RFC3339Nano)
+	scored, page := paginate(scored, fq, func(sp scoredPost) Cursor {
+		return Cursor{Key: sp.key, ID: sp.post.ID, Rank: fq.Rank, At: at}
+	})
+
+	feed := make([]PostWithMetadata, len(scored))
+	for i, sp := range scored {
+		feed[i] = sp.post
+	}
+
+	return feed, page, nil
+}
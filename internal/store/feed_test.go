@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/balebbae/sodia/internal/db/dbtest"
+)
+
+func newTestStorage(t *testing.T) Storage {
+	t.Helper()
+	return NewStorage(dbtest.New(t), Config{})
+}
+
+func createTestUser(t *testing.T, s Storage, username string) *User {
+	t.Helper()
+
+	user := &User{Username: username, Email: username + "@example.com", IsActive: true}
+	if err := user.Password.Set("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := withTx(s.Users.(*UserStore).db, context.Background(), func(tx *sql.Tx) error {
+		return s.Users.Create(context.Background(), tx, user)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+// createTestPost publishes a post and fans it out, as the create handler does.
+func createTestPost(t *testing.T, s Storage, userID int64, title string, tags ...string) *Post {
+	t.Helper()
+
+	post := &Post{UserID: userID, Title: title, Content: title, Tags: tags}
+	if err := s.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Timelines.FanOut(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	return post
+}
+
+// follow and unfollow keep the timeline in step, as the handlers do.
+func follow(t *testing.T, s Storage, followerID, userID int64) {
+	t.Helper()
+
+	if err := s.Followers.Follow(context.Background(), followerID, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Timelines.Backfill(context.Background(), followerID, userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func unfollow(t *testing.T, s Storage, followerID, userID int64) {
+	t.Helper()
+
+	if err := s.Followers.Unfollow(context.Background(), followerID, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Timelines.Prune(context.Background(), followerID, userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// feedCounts returns how many times each post appears in the user's feed,
+// along with the reason it was last seen with.
+func feedCounts(t *testing.T, s Storage, userID int64, excludeOwn bool) (map[int64]int, map[int64]string) {
+	t.Helper()
+
+	fq := PaginatedFeedQuery{Limit: 20, Sort: "desc", Rank: RankLatest, ExcludeOwn: excludeOwn}
+
+	feed, _, err := s.Posts.GetUserFeed(context.Background(), userID, fq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[int64]int{}
+	reasons := map[int64]string{}
+	for _, p := range feed {
+		counts[p.ID]++
+		reasons[p.ID] = p.Reason
+	}
+
+	return counts, reasons
+}
+
+func TestUserFeedShowsFollowedUsersPosts(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+
+	before := createTestPost(t, s, bob.ID, "before the follow")
+	follow(t, s, alice.ID, bob.ID)
+	after := createTestPost(t, s, bob.ID, "after the follow")
+
+	counts, reasons := feedCounts(t, s, alice.ID, false)
+
+	for _, p := range []*Post{before, after} {
+		if counts[p.ID] != 1 {
+			t.Errorf("post %q appears %d times, want 1", p.Title, counts[p.ID])
+		}
+		if reasons[p.ID] != ReasonFollowedUser {
+			t.Errorf("post %q has reason %q, want %q", p.Title, reasons[p.ID], ReasonFollowedUser)
+		}
+	}
+}
+
+func TestUserFeedHidesUnfollowedUsersPosts(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	carol := createTestUser(t, s, "carol")
+
+	follow(t, s, alice.ID, bob.ID)
+	bobs := createTestPost(t, s, bob.ID, "from bob")
+	carols := createTestPost(t, s, carol.ID, "from carol")
+	unfollow(t, s, alice.ID, bob.ID)
+
+	counts, _ := feedCounts(t, s, alice.ID, false)
+
+	if counts[bobs.ID] != 0 {
+		t.Errorf("post of an unfollowed user is still in the feed")
+	}
+	if counts[carols.ID] != 0 {
+		t.Errorf("post of a user never followed is in the feed")
+	}
+}
+
+func TestUserFeedShowsOwnPostsOnce(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+
+	// own posts would also be reached through the followed tag
+	if err := s.Tags.Follow(context.Background(), alice.ID, "golang"); err != nil {
+		t.Fatal(err)
+	}
+	own := createTestPost(t, s, alice.ID, "my post", "golang")
+
+	counts, reasons := feedCounts(t, s, alice.ID, false)
+
+	if counts[own.ID] != 1 {
+		t.Fatalf("own post appears %d times, want 1", counts[own.ID])
+	}
+	if reasons[own.ID] != ReasonOwn {
+		t.Errorf("own post has reason %q, want %q", reasons[own.ID], ReasonOwn)
+	}
+}
+
+func TestUserFeedExcludeOwn(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+
+	follow(t, s, alice.ID, bob.ID)
+	own := createTestPost(t, s, alice.ID, "my post")
+	bobs := createTestPost(t, s, bob.ID, "from bob")
+
+	counts, _ := feedCounts(t, s, alice.ID, true)
+
+	if counts[own.ID] != 0 {
+		t.Errorf("own post is in the feed despite exclude_own")
+	}
+	if counts[bobs.ID] != 1 {
+		t.Errorf("followed user's post appears %d times, want 1", counts[bobs.ID])
+	}
+}
+
+func TestUserFeedKeepsCelebrityPostsAfterLosingFollowers(t *testing.T) {
+	s := NewStorage(dbtest.New(t), Config{TimelineFanOutLimit: 2})
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	carol := createTestUser(t, s, "carol")
+
+	follow(t, s, alice.ID, bob.ID)
+	follow(t, s, carol.ID, bob.ID)
+	// bob has reached the limit, so this post is not copied to timelines
+	post := createTestPost(t, s, bob.ID, "from a celebrity")
+	unfollow(t, s, carol.ID, bob.ID)
+
+	counts, _ := feedCounts(t, s, alice.ID, false)
+
+	if counts[post.ID] != 1 {
+		t.Fatalf("celebrity post appears %d times after they lost a follower, want 1", counts[post.ID])
+	}
+}
+
+func TestFollowTwiceConflicts(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+
+	follow(t, s, alice.ID, bob.ID)
+
+	if err := s.Followers.Follow(context.Background(), alice.ID, bob.ID); err != ErrConflict {
+		t.Fatalf("got error %v, want ErrConflict", err)
+	}
+}
+
+func TestHighlightSnippetEscapesMarkup(t *testing.T) {
+	got := highlightSnippet(`<script>alert("x")</script> ` + highlightStart + "golang" + highlightStop + " & more")
+	want := `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <mark>golang</mark> &amp; more`
+
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSearchEscapesSnippets(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+
+	post := &Post{
+		UserID: alice.ID,
+		Title: "xss",
+		Content: `<script>alert(1)</script> learning golang ` + highlightStart + `<img src=x onerror=alert(2)>`,
+	}
+	if err := s.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	fq := PaginatedFeedQuery{Limit: 20, Sort: "desc", Rank: RankSearch, Search: "golang"}
+	results, _, err := s.Posts.Search(context.Background(), fq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+
+	snippet := results[0].Snippet
+	if strings.Contains(snippet, "<script>") || strings.Contains(snippet, "<img") {
+		t.Fatalf("snippet carries raw markup: %q", snippet)
+	}
+	if !strings.Contains(snippet, "&lt;script&gt;") {
+		t.Errorf("snippet doesn't carry the escaped content: %q", snippet)
+	}
+	if strings.Count(snippet, "<mark>") != 1 || strings.Count(snippet, "</mark>") != 1 {
+		t.Errorf("snippet should highlight the single match only: %q", snippet)
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent = "sent"
+	OutboxStatusDead = "dead"
+)
+
+type OutboxEmail struct {
+	ID int64 `json:"id"`
+	Template string `json:"template"`
+	Username string `json:"username"`
+	Email string `json:"email"`
+	Data any `json:"data"`
+	Status string `json:"status"`
+	Attempts int `json:"attempts"`
+	LastError string `json:"last_error"`
+	CreatedAt string `json:"created_at"`
+}
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// Enqueue queues an email for delivery inside the caller's transaction, so the
+// email exists if and only if the transaction commits.
+func (s *OutboxStore) Enqueue(ctx context.Context, tx *sql.Tx, email *OutboxEmail) error {
+	return enqueueEmail(ctx, tx, email)
+}
+
+// Claim locks up to limit pending emails that are due and pushes their next
+// attempt lease into the future, so other workers skip them while they are
+// being sent.
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxEmail, error) {
+	var emails []OutboxEmail
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE email_outbox SET next_attempt_at = $1
+			WHERE id IN (
+				SELECT id FROM email_outbox
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, template, username, email, data, attempts, created_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, query, time.Now().Add(lease), limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e OutboxEmail
+			var data []byte
+			err := rows.Scan(
+				&e.ID,
+				&e.Template,
+				&e.Username,
+				&e.Email,
+				&data,
+				&e.Attempts,
+				&e.CreatedAt,
+			)
+			if err != nil {
+				return err
+			}
+
+			var vars map[string]any
+			if err := json.Unmarshal(data, &vars); err != nil {
+				return err
+			}
+
+			e.Data = vars
+			e.Status = OutboxStatusPending
+			emails = append(emails, e)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// MarkSent records a delivered email. Its template data is cleared since it
+// may carry one-time links.
+func (s *OutboxStore) MarkSent(ctx context.Context, id int64) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'sent', attempts = attempts + 1, sent_at = NOW(), last_error = NULL, data = '{}'
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkFailed records a failed attempt. The email is retried at nextAttempt,
+// or dead-lettered when dead is set. Dead-lettered emails lose their template
+// data, like sent ones.
+func (s *OutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, nextAttempt time.Time, dead bool) error {
+	status := OutboxStatusPending
+	if dead {
+		status = OutboxStatusDead
+	}
+
+	query := `
+		UPDATE email_outbox
+		SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3,
+			data = CASE WHEN $5 THEN '{}' ELSE data END
+		WHERE id = $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, status, lastError, nextAttempt, id, dead)
+	return err
+}
+
+func enqueueEmail(ctx context.Context, tx *sql.Tx, email *OutboxEmail) error {
+	data, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO email_outbox (template, username, email, data)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		email.Template,
+		email.Username,
+		email.Email,
+		data,
+	).Scan(
+		&email.ID,
+		&email.Status,
+		&email.CreatedAt,
+	)
+}
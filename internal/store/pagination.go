@@ -1,40 +1,103 @@
 package store
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FieldErrors maps query parameters to what is wrong with them.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field, msg := range e {
+		fields = append(fields, field+": "+msg)
+	}
+	sort.Strings(fields)
+
+	return strings.Join(fields, ", ")
+}
+
 type PaginatedFeedQuery struct {
 	Limit int `json:"limit" validate:"gte=1,lte=20"`
 	Offset int `json:"offset" validate:"gte=0"`
 	Sort string `json:"sort" validate:"oneof=asc desc"`
 	Tags []string `json:"tags" validate:"max=5"`
 	Search string `json:"search" validate:"max=100"`
-	Since string `json:"since"`
-	Until string `json:"until"`
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	Cursor string `json:"cursor"`
+	ExcludeOwn bool `json:"exclude_own"`
+	Rank string `json:"rank" validate:"oneof=latest top relevant search"`
+
+	cursor *Cursor
+}
+
+// Cursor points at the item a page starts after (or before, when Prev is set).
+// Key is the value the feed is ordered by and ID breaks ties between items
+// sharing it. Rank and At pin the ranking the cursor was issued for.
+type Cursor struct {
+	Key string `json:"k"`
+	ID int64 `json:"id"`
+	Prev bool `json:"p,omitempty"`
+	Rank string `json:"r,omitempty"`
+	At string `json:"at,omitempty"`
+}
+
+// Page carries the opaque cursors of the pages around the one returned.
+type Page struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Key == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
 }
 
+// Parse reads the feed query from the URL. Malformed parameters are reported
+// together as FieldErrors.
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
 	qs := r.URL.Query()
+	errs := FieldErrors{}
 
-	limit := qs.Get("limit") // validate SHOULD catch but this happens BEFORE the validation
+	limit := qs.Get("limit")
 	if limit != "" {
 		l, err := strconv.Atoi(limit)
 		if err != nil {
-			return fq, nil
+			errs["limit"] = "must be an integer"
 		}
 
 		fq.Limit = l
 	}
 
-	offset := qs.Get("offset") // validate SHOULD catch but this happens BEFORE the validation
+	offset := qs.Get("offset")
 	if offset != "" {
 		l, err := strconv.Atoi(offset)
 		if err != nil {
-			return fq, nil
+			errs["offset"] = "must be an integer"
 		}
 
 		fq.Offset = l
@@ -47,7 +110,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 
 	tags := qs.Get("tags")
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		fq.Tags = NormalizeTags(strings.Split(tags, ","))
 	}
 
 	search := qs.Get("search")
@@ -55,26 +118,144 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Search = search
 	}
 
+	rank := qs.Get("rank")
+	if rank != "" {
+		fq.Rank = rank
+	}
+
+	excludeOwn := qs.Get("exclude_own")
+	if excludeOwn != "" {
+		b, err := strconv.ParseBool(excludeOwn)
+		if err != nil {
+			errs["exclude_own"] = "must be a boolean"
+		}
+
+		fq.ExcludeOwn = b
+	}
+
 	since := qs.Get("since")
 	if since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime(since)
+		if err != nil {
+			errs["since"] = err.Error()
+		}
+
+		fq.Since = t
 	}
 
 	until := qs.Get("until")
 	if until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime(until)
+		if err != nil {
+			errs["until"] = err.Error()
+		}
+
+		fq.Until = t
 	}
 
-	// until:= qs.Get("until")
+	if fq.Rank == RankSearch && fq.Search == "" {
+		errs["search"] = "is required by the search rank"
+	}
+
+	if !fq.Since.IsZero() && !fq.Until.IsZero() && fq.Until.Before(fq.Since) {
+		errs["until"] = "must not be before since"
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		switch {
+		case err != nil:
+			errs["cursor"] = "is not a valid cursor"
+		case c.Rank != "" && c.Rank != fq.Rank:
+			errs["cursor"] = "was issued for the " + c.Rank + " rank"
+		case !validCursorKey(fq.Rank, c.Key):
+			errs["cursor"] = "is not a valid cursor"
+		case c.At != "" && !validCursorTime(c.At):
+			errs["cursor"] = "is not a valid cursor"
+		}
+
+		fq.Cursor = cursor
+		fq.cursor = c
+		// a cursor already says where the page starts
+		fq.Offset = 0
+	}
+
+	if len(errs) > 0 {
+		return fq, errs
+	}
 
 	return fq, nil
 }
 
-func parseTime(s string) string {
+// paginate trims the extra row fetched to detect another page, restores the
+// requested order when walking backwards and works out the cursors around
+// the page.
+func paginate[T any](items []T, fq PaginatedFeedQuery, cursorOf func(T) Cursor) ([]T, Page) {
+	hasMore := len(items) > fq.Limit
+	if hasMore {
+		items = items[:fq.Limit]
+	}
+
+	backward := fq.cursor != nil && fq.cursor.Prev
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	var page Page
+	if len(items) == 0 {
+		return items, page
+	}
+
+	first, last := cursorOf(items[0]), cursorOf(items[len(items)-1])
+	first.Prev = true
+
+	if backward {
+		// we came from the page after this one
+		page.NextCursor = last.Encode()
+		if hasMore {
+			page.PrevCursor = first.Encode()
+		}
+		return items, page
+	}
+
+	if hasMore {
+		page.NextCursor = last.Encode()
+	}
+	if fq.cursor != nil || fq.Offset > 0 {
+		page.PrevCursor = first.Encode()
+	}
+
+	return items, page
+}
+
+// reverseOrder returns the opposite ORDER BY direction and keyset comparison.
+func reverseOrder(order string) (string, string) {
+	if order == "DESC" {
+		return "ASC", ">"
+	}
+
+	return "DESC", "<"
+}
+
+func validCursorTime(s string) bool {
+	_, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil
+}
+
+// parseTime accepts RFC 3339 timestamps as well as "2006-01-02 15:04:05",
+// which is read as UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
 	t, err := time.Parse(time.DateTime, s)
 	if err != nil {
-		return ""
+		return time.Time{}, errors.New("must be an RFC 3339 timestamp or YYYY-MM-DD HH:MM:SS")
 	}
 
-	return t.Format(time.DateTime)
-}
\ No newline at end of file
+	return t, nil
+}
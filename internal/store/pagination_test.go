@@ -0,0 +1,42 @@
+package store
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRejectsTamperedCursorKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		rank string
+		cursor Cursor
+		valid bool
+	}{
+		{"latest timestamp", RankLatest, Cursor{Key: "2024-05-01T10:00:00.123456Z", ID: 7, Rank: RankLatest}, true},
+		{"top score", RankTop, Cursor{Key: "0.0421", ID: 7, Rank: RankTop}, true},
+		{"legacy cursor without rank", RankLatest, Cursor{Key: "2024-05-01T10:00:00Z", ID: 7}, true},
+		{"latest with a number", RankLatest, Cursor{Key: "12", ID: 7, Rank: RankLatest}, false},
+		{"latest with garbage", RankLatest, Cursor{Key: "'; DROP TABLE posts; --", ID: 7, Rank: RankLatest}, false},
+		{"top with a timestamp", RankTop, Cursor{Key: "2024-05-01T10:00:00Z", ID: 7, Rank: RankTop}, false},
+		{"relevant with NaN", RankRelevant, Cursor{Key: "NaN", ID: 7, Rank: RankRelevant}, false},
+		{"malformed instant", RankTop, Cursor{Key: "0.5", ID: 7, Rank: RankTop, At: "yesterday"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/users/feed?rank="+tt.rank+"&cursor="+tt.cursor.Encode(), nil)
+
+			_, err := PaginatedFeedQuery{Limit: 20, Sort: "desc", Rank: RankLatest}.Parse(r)
+
+			if tt.valid && err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if !tt.valid {
+				errs, ok := err.(FieldErrors)
+				if !ok || errs["cursor"] == "" {
+					t.Fatalf("got error %v, want a cursor field error", err)
+				}
+			}
+		})
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+var ErrNotPublished = errors.New("only published posts can be pinned")
+
 type Post struct {
 	ID int64 `json:"id"`
 	Content string `json:"content"`
@@ -17,6 +20,13 @@ type Post struct {
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
 	Version int `json:"version"`
+	PinnedAt *string `json:"pinned_at,omitempty"`
+	DeletedAt *string `json:"deleted_at,omitempty"`
+	Status string `json:"status"`
+	// PublishAt is when a scheduled post goes live.
+	PublishAt *string `json:"publish_at,omitempty"`
+	// Edited is set once what the post says has changed, see its revisions.
+	Edited bool `json:"edited"`
 	Comments []Comment `json:"comments"`
 	User User `json:"user"`
 }
@@ -24,79 +34,263 @@ type Post struct {
 type PostWithMetadata struct {
 	Post
 	CommentsCount int64 `json:"comments_count"`
+	// Snippet is the HTML-escaped content around the search matches, which
+	// are wrapped in <mark>. It is safe to render as HTML.
+	Snippet string `json:"snippet,omitempty"`
+	// Reason says why the post is in a feed, one of the Reason constants.
+	Reason string `json:"reason,omitempty"`
 }
 
 type PostStore struct {
 	db *sql.DB
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+// Only published posts are visible to anyone but their author.
+const (
+	PostStatusDraft = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+// Feed reasons say why a post is in a user's feed.
+const (
+	ReasonOwn = "own"
+	ReasonFollowedUser = "followed_user"
+	ReasonFollowedTag = "followed_tag"
+	ReasonPinned = "pinned"
+)
+
+// GetUserFeed returns a page of the user's feed: posts by the accounts the
+// user follows or carrying the tags they follow, plus their own unless
+// fq.ExcludeOwn is set. Pages are walked with the keyset cursor in fq, which
+// stays stable while new posts arrive.
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, Page, error) {
+	q := newFeedQuery(userID, fq)
+	user := q.arg(userID)
+
+	// The materialized timeline holds the posts of followed users, except for
+	// celebrities, whose posts are read directly along with the user's own
+	// posts. followers rows are
+	// (user_id = followed, follower_id = follower). A post reached more than
+	// one way keeps the first reason in priority order.
+	source := `
+		SELECT DISTINCT ON (post_id) post_id, reason
+		FROM (
+			SELECT t.post_id, '` + ReasonFollowedUser + `' AS reason, 1 AS priority
+			FROM timelines t WHERE t.user_id = ` + user + `
+			UNION ALL
+			SELECT p.id, '` + ReasonOwn + `', 0
+			FROM posts p WHERE p.user_id = ` + user + ` AND NOT ` + q.arg(fq.ExcludeOwn) + `
+			UNION ALL
+			SELECT p.id, '` + ReasonFollowedUser + `', 1
+			FROM posts p
+			WHERE p.user_id IN (
+				SELECT f.user_id FROM followers f
+				JOIN users u ON u.id = f.user_id
+				WHERE f.follower_id = ` + user + ` AND u.is_celebrity
+			)
+			UNION ALL
+			SELECT p.id, '` + ReasonFollowedTag + `', 2
+			FROM posts p
+			WHERE p.tags && ARRAY(SELECT tf.tag FROM tag_follows tf WHERE tf.user_id = ` + user + `)
+			AND p.user_id <> ` + user + `
+		) reasons
+		ORDER BY post_id, priority
+	`
+
+	return s.listPosts(ctx, q, source, fq)
+}
+
+// Search returns a page of all posts matching fq.Search, which takes web
+// search syntax: quoted phrases, OR and -negation.
+func (s *PostStore) Search(ctx context.Context, fq PaginatedFeedQuery) ([]PostWithMetadata, Page, error) {
+	q := newFeedQuery(0, fq)
+	source := `SELECT p.id AS post_id, '' AS reason FROM posts p WHERE p.search @@ ` + q.tsquery
+
+	return s.listPosts(ctx, q, source, fq)
+}
+
+// GetByTag returns a page of all posts carrying tag, which must already be
+// normalized.
+func (s *PostStore) GetByTag(ctx context.Context, tag string, fq PaginatedFeedQuery) ([]PostWithMetadata, Page, error) {
+	q := newFeedQuery(0, fq)
+	source := `SELECT p.id AS post_id, '' AS reason FROM posts p WHERE p.tags @> ARRAY[` + q.arg(tag) + `]::varchar[]`
+
+	return s.listPosts(ctx, q, source, fq)
+}
+
+// GetByUser returns a page of the user's posts. The first page starts with
+// their pinned post, when it passes the filters in fq, which is otherwise
+// left out of the pages.
+func (s *PostStore) GetByUser(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, Page, error) {
+	var posts []PostWithMetadata
+
+	// The pinned post takes one of the first page's slots. Pages too small to
+	// hold it alongside another post list every post in plain order instead.
+	pinFirst := fq.Limit > 1
+
+	if pinFirst && fq.cursor == nil && fq.Offset == 0 {
+		pinnedFq := fq
+		pinnedFq.Limit = 1
+
+		q := newFeedQuery(userID, pinnedFq)
+		source := `SELECT p.id AS post_id, '` + ReasonPinned + `' AS reason FROM posts p WHERE p.user_id = ` + q.arg(userID) + ` AND p.pinned_at IS NOT NULL`
+
+		pinned, _, err := s.listPosts(ctx, q, source, pinnedFq)
+		if err != nil {
+			return nil, Page{}, err
+		}
+
+		posts = pinned
+		fq.Limit -= len(pinned)
+	}
+
+	q := newFeedQuery(userID, fq)
+	source := `SELECT p.id AS post_id, '' AS reason FROM posts p WHERE p.user_id = ` + q.arg(userID)
+	if pinFirst {
+		source += ` AND p.pinned_at IS NULL`
+	}
+
+	rest, page, err := s.listPosts(ctx, q, source, fq)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	return append(posts, rest...), page, nil
+}
+
+// GetDrafts returns a page of the user's draft and scheduled posts.
+func (s *PostStore) GetDrafts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, Page, error) {
+	q := newFeedQuery(userID, fq)
+	q.unpublished = true
+	source := `SELECT p.id AS post_id, '' AS reason FROM posts p WHERE p.user_id = ` + q.arg(userID)
+
+	return s.listPosts(ctx, q, source, fq)
+}
+
+// PublishDue publishes up to limit scheduled posts whose time has come, dated
+// from when they were scheduled for. Publishing bumps their version like an
+// edit does, keeping the scheduled version as a revision. Rows locked by
+// another replica doing the same are skipped.
+func (s *PostStore) PublishDue(ctx context.Context, limit int) ([]Post, error) {
 	query := `
-		SELECT
-			p.id,
-			p.user_id,
-			p.title,
-			p.content,
-			p.created_at,
-			p.version,
-			p.tags,
-			u.username,
-			COUNT(c.id) AS comments_count
-		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f
-			ON f.follower_id = p.user_id
-		OR p.user_id = $1
-		WHERE
-			f.user_id = $1 AND
-			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-			(p.tags @> $5 OR $5 = '{}')
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
-		LIMIT $2 OFFSET $3
+		WITH due AS (
+			SELECT id FROM posts
+			WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+			ORDER BY publish_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		),
+		revisions AS (
+			INSERT INTO post_revisions (post_id, version, title, content, tags)
+			SELECT p.id, p.version, p.title, p.content, p.tags
+			FROM posts p
+			JOIN due ON due.id = p.id
+		)
+		UPDATE posts SET status = 'published', created_at = publish_at, version = version + 1
+		WHERE id IN (SELECT id FROM due)
+		RETURNING id, user_id, title, created_at, status
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.QueryContext(ctx, query, limit)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	var feed []PostWithMetadata
+	var posts []Post
 	for rows.Next() {
-		var p PostWithMetadata
-		err := rows.Scan(
-			&p.ID,
-			&p.UserID,
-			&p.Title,
-			&p.Content,
-			&p.CreatedAt,
-			&p.Version,
-			pq.Array(&p.Tags),
-			&p.User.Username,
-			&p.CommentsCount,
-		)
-		if err != nil {
+		var p Post
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.CreatedAt, &p.Status); err != nil {
 			return nil, err
 		}
 
-		feed = append(feed, p)
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// Pin makes post its author's pinned post, unpinning any other. Drafts and
+// scheduled posts can't be pinned and return ErrNotPublished.
+func (s *PostStore) Pin(ctx context.Context, post *Post) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var status string
+		query := `SELECT status FROM posts WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.QueryRowContext(ctx, query, post.ID).Scan(&status); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if status != PostStatusPublished {
+			return ErrNotPublished
+		}
+
+		query = `UPDATE posts SET pinned_at = NULL WHERE user_id = $1 AND pinned_at IS NOT NULL AND id <> $2`
+		if _, err := tx.ExecContext(ctx, query, post.UserID, post.ID); err != nil {
+			return err
+		}
+
+		query = `UPDATE posts SET pinned_at = COALESCE(pinned_at, NOW()) WHERE id = $1 AND deleted_at IS NULL RETURNING pinned_at, updated_at`
+		err := tx.QueryRowContext(ctx, query, post.ID).Scan(&post.PinnedAt, &post.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				// a concurrent pin of another post by the same author
+				if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+					return ErrConflict
+				}
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *PostStore) Unpin(ctx context.Context, post *Post) error {
+	query := `UPDATE posts SET pinned_at = NULL WHERE id = $1 AND deleted_at IS NULL RETURNING updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, post.ID).Scan(&post.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
 	}
 
-	return feed, nil
+	post.PinnedAt = nil
+	return nil
 }
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at 
+		INSERT INTO posts (content, title, user_id, tags, status, publish_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at 
 	`
 
+	if post.Status == "" {
+		post.Status = PostStatusPublished
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
@@ -107,6 +301,8 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 		post.Title,
 		post.UserID,
 		pq.Array(post.Tags),
+		post.Status,
+		post.PublishAt,
 	).Scan(
 		&post.ID,
 		&post.CreatedAt,
@@ -120,20 +316,30 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 }
 
 func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
+	return s.getByID(ctx, id, false)
+}
+
+// GetTrashedByID returns a deleted post that hasn't been purged yet.
+func (s *PostStore) GetTrashedByID(ctx context.Context, id int64) (*Post, error) {
+	return s.getByID(ctx, id, true)
+}
+
+func (s *PostStore) getByID(ctx context.Context, id int64, trashed bool) (*Post, error) {
 	query := `
 		SELECT 
-			id, user_id, title, content, created_at, tags, updated_at, version 
+			id, user_id, title, content, created_at, tags, updated_at, version, pinned_at, deleted_at,
+			status, publish_at, ` + editedColumn("posts") + `
 		FROM 
 			posts 
 		WHERE 
-			id = $1`
+			id = $1 AND (deleted_at IS NOT NULL) = $2`
 
 	var post Post
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query,id).Scan(
+	err := s.db.QueryRowContext(ctx, query, id, trashed).Scan(
 		&post.ID,
 		&post.UserID,
 		&post.Title,
@@ -142,6 +348,11 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		pq.Array(&post.Tags),
 		&post.UpdatedAt,
 		&post.Version,
+		&post.PinnedAt,
+		&post.DeletedAt,
+		&post.Status,
+		&post.PublishAt,
+		&post.Edited,
 	)
 
 	if err != nil {
@@ -152,44 +363,102 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 			return nil, err
 		}
 	}
-	
+
 	return &post, nil
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
-	query := `
-		UPDATE posts
-		SET title = $1,
-		    content = $2,
-			version = version + 1
-		WHERE id = $3 AND version = $4
-		RETURNING version
-	`
+// Update saves the edited post if it is still at post.Version, keeping the
+// version it replaces as a revision. It reports whether this update is what
+// published the post.
+func (s *PostStore) Update(ctx context.Context, post *Post) (bool, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
-		ctx, 
-		query, 
-		post.Title, 
-		post.Content, 
-		post.ID, 
-		post.Version,
-	).Scan(&post.Version)
+	published := false
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var status string
+		query := `SELECT status FROM posts WHERE id = $1 AND version = $2 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.QueryRowContext(ctx, query, post.ID, post.Version).Scan(&status); err != nil {
+			return err
+		}
+
+		if err := createRevision(ctx, tx, post.ID, post.Version); err != nil {
+			return err
+		}
+
+		// updated_at is set by the posts_set_updated_at trigger. A post is
+		// dated from when it is published and is never unpublished.
+		query = `
+			UPDATE posts
+			SET title = $1,
+			    content = $2,
+				tags = $3,
+				status = CASE WHEN status = 'published' THEN status ELSE $4 END,
+				publish_at = CASE WHEN status = 'published' THEN publish_at ELSE $5 END,
+				created_at = CASE
+					WHEN status <> 'published' AND $4 = 'published' THEN NOW()
+					ELSE created_at
+				END,
+				version = version + 1
+			WHERE id = $6 AND version = $7 AND deleted_at IS NULL
+			RETURNING version, created_at, updated_at, status, publish_at, ` + editedColumn("posts") + `
+		`
+
+		err := tx.QueryRowContext(
+			ctx, 
+			query, 
+			post.Title, 
+			post.Content, 
+			pq.Array(post.Tags),
+			post.Status,
+			post.PublishAt,
+			post.ID, 
+			post.Version,
+		).Scan(&post.Version, &post.CreatedAt, &post.UpdatedAt, &post.Status, &post.PublishAt, &post.Edited)
+		if err != nil {
+			return err
+		}
+
+		// the row is locked, so no one else published it in between
+		published = status != PostStatusPublished && post.Status == PostStatusPublished
+		return nil
+	})
 
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
+		case errors.Is(err, sql.ErrNoRows), errors.Is(err, ErrEditConflict):
+			return false, s.missingOrConflict(ctx, post.ID)
 		default:
-			return err
+			return false, err
 		}
 	}
-	return nil
+
+	return published, nil
 }
 
+// missingOrConflict tells why a versioned write to a post matched no row:
+// ErrNotFound when the post is gone, ErrEditConflict when another write
+// bumped its version first.
+func (s *PostStore) missingOrConflict(ctx context.Context, postID int64) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL)`, postID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return ErrEditConflict
+}
+
+// Delete moves a post to the trash, where it can be restored until the
+// restore window passes and stays until it is purged. Deleting a post also
+// unpins it.
 func (s *PostStore) Delete(ctx context.Context, postID int64) error {
-	query := `DELETE FROM posts WHERE id = $1`
+	query := `UPDATE posts SET deleted_at = NOW(), pinned_at = NULL WHERE id = $1 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -209,4 +478,21 @@ func (s *PostStore) Delete(ctx context.Context, postID int64) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// Restore takes a post out of the trash if it was deleted within window.
+func (s *PostStore) Restore(ctx context.Context, postID int64, window time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return restore(ctx, s.db, "posts", postID, window)
+}
+
+// Purge permanently deletes the posts trashed longer than retention ago,
+// along with their comments, revisions and timeline entries.
+func (s *PostStore) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return purge(ctx, s.db, "posts", retention)
+}
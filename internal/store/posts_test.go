@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetByUserKeepsPinnedPostWithinLimit(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+
+	var posts []*Post
+	for _, title := range []string{"first", "second", "third", "fourth"} {
+		posts = append(posts, createTestPost(t, s, alice.ID, title))
+	}
+
+	pinned := posts[0]
+	if err := s.Posts.Pin(context.Background(), pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	fq := PaginatedFeedQuery{Limit: 2, Sort: "desc", Rank: RankLatest}
+	page, _, err := s.Posts.GetByUser(context.Background(), alice.ID, fq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != fq.Limit {
+		t.Fatalf("got %d posts, want %d", len(page), fq.Limit)
+	}
+	if page[0].ID != pinned.ID || page[0].Reason != ReasonPinned {
+		t.Errorf("first post is %d (%q), want the pinned post %d", page[0].ID, page[0].Reason, pinned.ID)
+	}
+	if page[1].ID != posts[3].ID {
+		t.Errorf("second post is %d, want the latest post %d", page[1].ID, posts[3].ID)
+	}
+}
+
+func TestPinRejectsDrafts(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+
+	draft := &Post{UserID: alice.ID, Title: "draft", Content: "draft", Status: PostStatusDraft}
+	if err := s.Posts.Create(context.Background(), draft); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Posts.Pin(context.Background(), draft); err != ErrNotPublished {
+		t.Fatalf("got error %v, want ErrNotPublished", err)
+	}
+}
+
+func TestUpdatedAtOnlyMovesOnEdits(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+	post := createTestPost(t, s, alice.ID, "original")
+	other := createTestPost(t, s, alice.ID, "other")
+	created := post.UpdatedAt
+
+	// updated_at has a precision of a second
+	time.Sleep(1100 * time.Millisecond)
+
+	if err := s.Posts.Pin(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	// pinning another post unpins this one behind the scenes
+	if err := s.Posts.Pin(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	pinned, err := s.Posts.GetByID(context.Background(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned.UpdatedAt != created {
+		t.Fatalf("pinning moved updated_at from %s to %s", created, pinned.UpdatedAt)
+	}
+
+	pinned.Title = "edited"
+	if _, err := s.Posts.Update(context.Background(), pinned); err != nil {
+		t.Fatal(err)
+	}
+	if pinned.UpdatedAt == created {
+		t.Fatalf("editing left updated_at at %s", created)
+	}
+}
+
+func TestPublishDueBumpsVersion(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+
+	publishAt := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	post := &Post{UserID: alice.ID, Title: "scheduled", Content: "scheduled", Status: PostStatusScheduled, PublishAt: &publishAt}
+	if err := s.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := s.Posts.PublishDue(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0].ID != post.ID {
+		t.Fatalf("got %+v, want the scheduled post only", published)
+	}
+
+	got, err := s.Posts.GetByID(context.Background(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != PostStatusPublished || got.Version != post.Version+1 {
+		t.Errorf("got status %q at version %d, want %q at version %d", got.Status, got.Version, PostStatusPublished, post.Version+1)
+	}
+	if got.Edited {
+		t.Errorf("publishing on schedule marked the post edited")
+	}
+
+	if _, err := s.Revisions.Get(context.Background(), post.ID, post.Version); err != nil {
+		t.Errorf("the scheduled version wasn't kept as a revision: %v", err)
+	}
+
+	// an edit based on the scheduled version lost the race
+	post.Status = PostStatusPublished
+	if _, err := s.Posts.Update(context.Background(), post); err != ErrEditConflict {
+		t.Errorf("got error %v, want ErrEditConflict", err)
+	}
+}
+
+func TestUpdateReportsPublishingOnce(t *testing.T) {
+	s := newTestStorage(t)
+	alice := createTestUser(t, s, "alice")
+
+	post := &Post{UserID: alice.ID, Title: "draft", Content: "draft", Status: PostStatusDraft}
+	if err := s.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	post.Status = PostStatusPublished
+	published, err := s.Posts.Update(context.Background(), post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !published {
+		t.Fatalf("publishing a draft wasn't reported")
+	}
+
+	post.Title = "edited"
+	published, err = s.Posts.Update(context.Background(), post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published {
+		t.Fatalf("editing a published post was reported as publishing it")
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	RankLatest = "latest"
+	RankTop = "top"
+	RankRelevant = "relevant"
+	RankSearch = "search"
+)
+
+// feedScorer decides the order of a feed. Posts are ordered by the score
+// expression, with the post id breaking ties.
+type feedScorer interface {
+	// with returns extra common table expressions the score relies on,
+	// each preceded by a comma.
+	with(q *feedQuery) string
+	// score returns an SQL expression over the base row b.
+	score(q *feedQuery) string
+	// keyType is the SQL type of the score, used to read cursors back.
+	keyType() string
+}
+
+var feedScorers = map[string]feedScorer{
+	RankLatest: latestScorer{},
+	RankTop: topScorer{gravity: 1.5},
+	RankRelevant: relevantScorer{gravity: 1.2},
+	RankSearch: searchScorer{},
+}
+
+// latestScorer orders posts chronologically.
+type latestScorer struct{}
+
+func (latestScorer) with(*feedQuery) string { return "" }
+
+func (latestScorer) score(*feedQuery) string { return "b.created_at" }
+
+func (latestScorer) keyType() string { return "timestamptz" }
+
+// topScorer ranks posts by engagement, decayed by age the way Hacker News
+// does: (comments + 1) / (age in hours + 2) ^ gravity. Comments are the only
+// engagement we record for now.
+type topScorer struct {
+	gravity float64
+}
+
+func (topScorer) with(*feedQuery) string { return "" }
+
+func (s topScorer) score(q *feedQuery) string {
+	return fmt.Sprintf("((b.comments_count + 1)::double precision / %s)", decay(q, s.gravity))
+}
+
+func (topScorer) keyType() string { return "double precision" }
+
+// relevantScorer favours posts carrying the tags the user interacts with,
+// weighted by how often they commented on or wrote posts with that tag, and
+// decayed by age like topScorer.
+type relevantScorer struct {
+	gravity float64
+}
+
+func (relevantScorer) with(q *feedQuery) string {
+	userID := q.arg(q.userID)
+
+	return `,
+		affinity AS (
+			SELECT lower(tag) AS tag, COUNT(*) AS weight
+			FROM (
+				SELECT unnest(p.tags) AS tag
+				FROM comments c
+				JOIN posts p ON p.id = c.post_id
+				WHERE c.user_id = ` + userID + ` AND c.deleted_at IS NULL AND p.deleted_at IS NULL
+				UNION ALL
+				SELECT unnest(p.tags) FROM posts p WHERE p.user_id = ` + userID + ` AND p.deleted_at IS NULL
+			) interactions
+			GROUP BY lower(tag)
+		)`
+}
+
+func (s relevantScorer) score(q *feedQuery) string {
+	affinity := `(SELECT COALESCE(SUM(a.weight), 0) FROM affinity a WHERE a.tag IN (SELECT lower(t.tag) FROM unnest(b.tags) AS t(tag)))`
+
+	return fmt.Sprintf("((1 + %s)::double precision / %s)", affinity, decay(q, s.gravity))
+}
+
+func (relevantScorer) keyType() string { return "double precision" }
+
+// searchScorer ranks posts by how well they match the search terms, title
+// matches counting more than content ones. It needs a search to rank by.
+type searchScorer struct{}
+
+func (searchScorer) with(*feedQuery) string { return "" }
+
+func (searchScorer) score(q *feedQuery) string {
+	return "ts_rank(b.search, " + q.tsquery + ")"
+}
+
+func (searchScorer) keyType() string { return "real" }
+
+// validCursorKey reports whether key reads back as a score of the rank's
+// type, so a tampered cursor is turned away before it reaches the query.
+func validCursorKey(rank, key string) bool {
+	scorer, ok := feedScorers[rank]
+	if !ok {
+		scorer = feedScorers[RankLatest]
+	}
+
+	switch scorer.keyType() {
+	case "timestamptz":
+		return validCursorTime(key)
+	default:
+		f, err := strconv.ParseFloat(key, 64)
+		return err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	}
+}
+
+// decay is (age in hours at q.at + 2) ^ gravity.
+func decay(q *feedQuery, gravity float64) string {
+	return fmt.Sprintf(
+		"power(GREATEST(EXTRACT(EPOCH FROM (%s::timestamptz - b.created_at)), 0)::double precision / 3600 + 2, %s::double precision)",
+		q.arg(q.at),
+		q.arg(gravity),
+	)
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// PostRevision is a post as it was at Version, before an edit replaced it.
+type PostRevision struct {
+	PostID int64 `json:"post_id"`
+	Version int `json:"version"`
+	Title string `json:"title"`
+	Content string `json:"content"`
+	Tags []string `json:"tags"`
+	ReplacedAt string `json:"replaced_at,omitempty"`
+}
+
+type RevisionStore struct {
+	db *sql.DB
+}
+
+// GetByPostID returns the past revisions of a post, latest first.
+func (s *RevisionStore) GetByPostID(ctx context.Context, postID int64) ([]PostRevision, error) {
+	query := `
+		SELECT post_id, version, title, content, tags, replaced_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY version DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var r PostRevision
+		err := rows.Scan(&r.PostID, &r.Version, &r.Title, &r.Content, pq.Array(&r.Tags), &r.ReplacedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, r)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *RevisionStore) Get(ctx context.Context, postID int64, version int) (*PostRevision, error) {
+	query := `
+		SELECT post_id, version, title, content, tags, replaced_at
+		FROM post_revisions
+		WHERE post_id = $1 AND version = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var r PostRevision
+	err := s.db.QueryRowContext(ctx, query, postID, version).Scan(
+		&r.PostID,
+		&r.Version,
+		&r.Title,
+		&r.Content,
+		pq.Array(&r.Tags),
+		&r.ReplacedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &r, nil
+}
+
+// editedColumn tells whether the post under alias has an earlier version that
+// reads differently. Publishing a scheduled post keeps a revision without
+// changing a word, so it doesn't make the post edited.
+func editedColumn(alias string) string {
+	return `EXISTS (
+		SELECT 1 FROM post_revisions r
+		WHERE r.post_id = ` + alias + `.id
+		AND (r.title, r.content, r.tags) IS DISTINCT FROM (` + alias + `.title, ` + alias + `.content, ` + alias + `.tags)
+	)`
+}
+
+// createRevision saves the post at version as a revision inside the
+// caller's transaction, before it is edited. It returns ErrEditConflict when
+// the post is no longer at version, or another edit of it is in flight.
+func createRevision(ctx context.Context, tx *sql.Tx, postID int64, version int) error {
+	query := `
+		INSERT INTO post_revisions (post_id, version, title, content, tags)
+		SELECT id, version, title, content, tags
+		FROM posts
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	`
+
+	res, err := tx.ExecContext(ctx, query, postID, version)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
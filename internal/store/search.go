@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UserSearchQuery finds users by username.
+type UserSearchQuery struct {
+	Query string `json:"q" validate:"required,max=50"`
+	Limit int `json:"limit" validate:"gte=1,lte=20"`
+	Offset int `json:"offset" validate:"gte=0"`
+	// Autocomplete asks for just the id and username of each match, for
+	// typeahead.
+	Autocomplete bool `json:"autocomplete"`
+}
+
+// UserSearchResult is a user found by a search, with how they relate to the
+// user searching.
+type UserSearchResult struct {
+	ID int64 `json:"id"`
+	Username string `json:"username"`
+	CreatedAt string `json:"created_at"`
+	Following bool `json:"following"`
+	FollowsYou bool `json:"follows_you"`
+}
+
+// Parse reads the user search from the URL. Malformed parameters are
+// reported together as FieldErrors.
+func (usq UserSearchQuery) Parse(r *http.Request) (UserSearchQuery, error) {
+	qs := r.URL.Query()
+	errs := FieldErrors{}
+
+	usq.Query = strings.TrimSpace(qs.Get("q"))
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			errs["limit"] = "must be an integer"
+		}
+
+		usq.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		l, err := strconv.Atoi(offset)
+		if err != nil {
+			errs["offset"] = "must be an integer"
+		}
+
+		usq.Offset = l
+	}
+
+	autocomplete := qs.Get("autocomplete")
+	if autocomplete != "" {
+		b, err := strconv.ParseBool(autocomplete)
+		if err != nil {
+			errs["autocomplete"] = "must be a boolean"
+		}
+
+		usq.Autocomplete = b
+	}
+
+	if len(errs) > 0 {
+		return usq, errs
+	}
+
+	return usq, nil
+}
+
+// Search finds the active users whose username starts with or resembles
+// usq.Query. Mutual follows of viewerID come first, then the users they
+// follow, then prefix matches, then the closest matches.
+func (s *UserStore) Search(ctx context.Context, viewerID int64, usq UserSearchQuery) ([]UserSearchResult, error) {
+	// % is pg_trgm's similarity operator
+	query := `
+		SELECT id, username, created_at, following, follows_you
+		FROM (
+			SELECT
+				u.id,
+				u.username,
+				u.created_at,
+				EXISTS (
+					SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $1
+				) AS following,
+				EXISTS (
+					SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = u.id
+				) AS follows_you,
+				u.username ILIKE $2 AS prefix,
+				similarity(u.username, $3) AS similarity
+			FROM users u
+			WHERE u.is_active AND NOT u.is_suspended
+			AND (u.username ILIKE $2 OR u.username % $3)
+		) matches
+		ORDER BY
+			following AND follows_you DESC,
+			following DESC,
+			prefix DESC,
+			similarity DESC,
+			username
+		LIMIT $4 OFFSET $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, escapeLike(usq.Query)+"%", usq.Query, usq.Limit, usq.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []UserSearchResult{}
+	for rows.Next() {
+		var u UserSearchResult
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt, &u.Following, &u.FollowsYou); err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrTokenReused = errors.New("refresh token has already been used")
+
+type Session struct {
+	ID int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	UserAgent string `json:"user_agent"`
+	IP string `json:"ip"`
+	CreatedAt string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	Expiry string `json:"expires_at"`
+	Current bool `json:"current"`
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+// Create opens a new session for the user and stores its first refresh token.
+// The token is expected to be already hashed.
+func (s *SessionStore) Create(ctx context.Context, session *Session, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO sessions (user_id, user_agent, ip, expiry)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, last_used_at, expiry
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			session.UserID,
+			session.UserAgent,
+			session.IP,
+			time.Now().Add(exp),
+		).Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+		)
+		if err != nil {
+			return err
+		}
+
+		return s.createRefreshToken(ctx, tx, token, exp, session.ID)
+	})
+}
+
+// Rotate exchanges a refresh token for a new one within the same session.
+// Presenting a token that was already exchanged revokes the whole session
+// and returns ErrTokenReused.
+func (s *SessionStore) Rotate(ctx context.Context, oldToken, newToken string, exp time.Duration) (*Session, error) {
+	var session *Session
+	reused := false
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT s.id, s.user_id, s.user_agent, s.ip, s.created_at, rt.used_at IS NOT NULL
+			FROM refresh_tokens rt
+			JOIN sessions s ON s.id = rt.session_id
+			WHERE rt.token = $1 AND rt.expiry > $2 AND s.revoked_at IS NULL
+			FOR UPDATE OF rt, s
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		session = &Session{}
+		var used bool
+		err := tx.QueryRowContext(ctx, query, oldToken, time.Now()).Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&used,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if used {
+			reused = true
+			return s.revoke(ctx, tx, session.ID)
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE token = $1`, oldToken); err != nil {
+			return err
+		}
+
+		if err := s.createRefreshToken(ctx, tx, newToken, exp, session.ID); err != nil {
+			return err
+		}
+
+		return tx.QueryRowContext(
+			ctx,
+			`UPDATE sessions SET last_used_at = NOW(), expiry = $1 WHERE id = $2 RETURNING last_used_at, expiry`,
+			time.Now().Add(exp),
+			session.ID,
+		).Scan(&session.LastUsedAt, &session.Expiry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		return nil, ErrTokenReused
+	}
+
+	return session, nil
+}
+
+func (s *SessionStore) GetByUserID(ctx context.Context, userID int64) ([]Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip, created_at, last_used_at, expiry
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expiry > $2
+		ORDER BY last_used_at DESC;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Validate checks that the session belongs to the user and has been neither
+// revoked nor expired. Sessions that fail the check return ErrNotFound.
+func (s *SessionStore) Validate(ctx context.Context, sessionID, userID int64) error {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expiry > $3
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var active bool
+	if err := s.db.QueryRowContext(ctx, query, sessionID, userID, time.Now()).Scan(&active); err != nil {
+		return err
+	}
+
+	if !active {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Revoke signs out a single session belonging to the user.
+func (s *SessionStore) Revoke(ctx context.Context, sessionID, userID int64) error {
+	query := `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SessionStore) revoke(ctx context.Context, tx *sql.Tx, sessionID int64) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, sessionID)
+	return err
+}
+
+func (s *SessionStore) createRefreshToken(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, sessionID int64) error {
+	query := `INSERT INTO refresh_tokens (token, session_id, expiry) VALUES ($1, $2, $3);`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, token, sessionID, time.Now().Add(exp))
+	return err
+}
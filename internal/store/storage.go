@@ -10,6 +10,7 @@ import (
 var (
 	ErrNotFound = errors.New("resource not found")
 	ErrConflict = errors.New("recourse already exists")
+	ErrEditConflict = errors.New("resource was modified by another request")
 	QueryTimeoutDuration = time.Second * 5
 )
 
@@ -18,32 +19,107 @@ type Storage struct {
 		GetByID(context.Context, int64) (*Post, error)
 		Create(context.Context, *Post) error
 		Delete(context.Context, int64) error
-		Update(context.Context, *Post) error
-		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		Update(context.Context, *Post) (bool, error)
+		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, Page, error)
+		Search(context.Context, PaginatedFeedQuery) ([]PostWithMetadata, Page, error)
+		GetByTag(context.Context, string, PaginatedFeedQuery) ([]PostWithMetadata, Page, error)
+		GetByUser(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, Page, error)
+		GetDrafts(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, Page, error)
+		PublishDue(context.Context, int) ([]Post, error)
+		Pin(context.Context, *Post) error
+		Unpin(context.Context, *Post) error
+		GetTrashedByID(context.Context, int64) (*Post, error)
+		Restore(context.Context, int64, time.Duration) error
+		Purge(context.Context, time.Duration) (int64, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
 		GetByID(context.Context,int64) (*User, error)
-		CreateAndInvite(context.Context, *User, string, time.Duration) error
+		GetByEmail(context.Context, string) (*User, error)
+		CreateAndInvite(context.Context, *User, string, time.Duration, *OutboxEmail) error
 		Activate(context.Context, string) error
+		ResendInvitation(context.Context, int64, string, time.Duration, *OutboxEmail) error
+		DeleteUnactivated(context.Context, time.Duration) (int64, error)
+		UpdateStatus(context.Context, int64, int64, bool, string) error
+		CreatePasswordReset(context.Context, int64, string, time.Duration, *OutboxEmail) error
+		ResetPassword(context.Context, string, *User) error
 		Delete(context.Context, int64) error
+		Search(context.Context, int64, UserSearchQuery) ([]UserSearchResult, error)
 	}
 	Comments interface {
 		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
 		Create(context.Context, *Comment) error
+		Delete(context.Context, int64) error
+		GetTrashedByID(context.Context, int64) (*Comment, error)
+		Restore(context.Context, int64, time.Duration) error
+		Purge(context.Context, time.Duration) (int64, error)
 	}
 	Followers interface {
 		Follow(ctx context.Context, followerID, userID int64) error
 		Unfollow(ctx context.Context, followerID, userID int64) error
 	}
+	Roles interface {
+		GetByName(context.Context, string) (*Role, error)
+	}
+	Sessions interface {
+		Create(context.Context, *Session, string, time.Duration) error
+		Rotate(context.Context, string, string, time.Duration) (*Session, error)
+		GetByUserID(context.Context, int64) ([]Session, error)
+		Validate(context.Context, int64, int64) error
+		Revoke(context.Context, int64, int64) error
+	}
+	Timelines interface {
+		FanOut(context.Context, *Post) error
+		Backfill(ctx context.Context, followerID, userID int64) error
+		Prune(ctx context.Context, followerID, userID int64) error
+	}
+	Revisions interface {
+		GetByPostID(context.Context, int64) ([]PostRevision, error)
+		Get(context.Context, int64, int) (*PostRevision, error)
+	}
+	Tags interface {
+		Trending(context.Context, time.Duration, int) ([]TrendingTag, error)
+		Follow(context.Context, int64, string) error
+		Unfollow(context.Context, int64, string) error
+	}
+	Outbox interface {
+		Enqueue(context.Context, *sql.Tx, *OutboxEmail) error
+		Claim(context.Context, int, time.Duration) ([]OutboxEmail, error)
+		MarkSent(context.Context, int64) error
+		MarkFailed(context.Context, int64, string, time.Time, bool) error
+	}
 }
 
-func NewStorage(db *sql.DB) Storage {
+// Config tunes the stores. Zero fields fall back to the defaults.
+type Config struct {
+	TimelineFanOutLimit int
+	TimelineBackfillLimit int
+	TrendingMinPosts int
+}
+
+func NewStorage(db *sql.DB, cfg Config) Storage {
+	if cfg.TimelineFanOutLimit == 0 {
+		cfg.TimelineFanOutLimit = 10_000
+	}
+	if cfg.TimelineBackfillLimit == 0 {
+		cfg.TimelineBackfillLimit = 100
+	}
+	if cfg.TrendingMinPosts == 0 {
+		cfg.TrendingMinPosts = 2
+	}
+
 	return Storage{
 		Posts: &PostStore{db},
 		Users: &UserStore{db},
 		Comments: &CommentStore{db},
 		Followers: &FollowerStore{db},
+		Sessions: &SessionStore{db},
+		Roles: &RoleStore{db},
+		Outbox: &OutboxStore{db},
+		Timelines: &TimelineStore{db, cfg.TimelineFanOutLimit, cfg.TimelineBackfillLimit},
+		Tags: &TagStore{db, cfg.TrendingMinPosts},
+		Revisions: &RevisionStore{db},
 	}
 }
 
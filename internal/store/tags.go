@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TrendingTag is a tag gaining use. Velocity is the growth of its use over
+// the previous window of the same length: (posts - previous posts) /
+// (previous posts + 1).
+type TrendingTag struct {
+	Tag string `json:"tag"`
+	Posts int64 `json:"posts"`
+	PreviousPosts int64 `json:"previous_posts"`
+	Velocity float64 `json:"velocity"`
+}
+
+type TagStore struct {
+	db *sql.DB
+	// trendingMinPosts is how many posts a tag needs within the window to
+	// trend, so a single post doesn't show up as infinite growth.
+	trendingMinPosts int
+}
+
+// NormalizeTag case-folds tag, trims it and collapses inner whitespace, so
+// "  Web   Development" and "web development" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// NormalizeTags normalizes each tag, dropping empty ones and duplicates while
+// keeping the order they were given in.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+// Follow adds tag, which must already be normalized, to the tags the user
+// follows.
+func (s *TagStore) Follow(ctx context.Context, userID int64, tag string) error {
+	query := `INSERT INTO tag_follows (user_id, tag) VALUES ($1, $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, tag)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *TagStore) Unfollow(ctx context.Context, userID int64, tag string) error {
+	query := `DELETE FROM tag_follows WHERE user_id = $1 AND tag = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, tag)
+	return err
+}
+
+// Trending returns the tags whose use grew the most in the last window
+// compared to the window before it.
+func (s *TagStore) Trending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error) {
+	query := `
+		SELECT tag, recent, previous, (recent - previous)::double precision / (previous + 1) AS velocity
+		FROM (
+			SELECT
+				t.tag,
+				COUNT(*) FILTER (WHERE p.created_at >= $1) AS recent,
+				COUNT(*) FILTER (WHERE p.created_at < $1) AS previous
+			FROM posts p
+			CROSS JOIN LATERAL unnest(p.tags) AS t(tag)
+			WHERE p.created_at >= $2 AND p.deleted_at IS NULL AND p.status = 'published'
+			GROUP BY t.tag
+		) counts
+		WHERE recent >= $3
+		ORDER BY velocity DESC, recent DESC, tag
+		LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	now := time.Now()
+	rows, err := s.db.QueryContext(ctx, query, now.Add(-window), now.Add(-2*window), s.trendingMinPosts, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.Posts, &t.PreviousPosts, &t.Velocity); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
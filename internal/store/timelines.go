@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TimelineStore materializes home timelines in Postgres (fan-out on write).
+//
+// Authors whose follower count reaches fanOutLimit are flagged as celebrities
+// and their posts are no longer copied: the feed reads them directly instead.
+// The flag sticks even if they later lose followers, since the posts they
+// published in the meantime were never materialized.
+type TimelineStore struct {
+	db *sql.DB
+	// fanOutLimit is the follower count from which an author is a celebrity.
+	fanOutLimit int
+	// backfillLimit is how many recent posts of a newly followed user are
+	// copied into the follower's timeline. Older posts are not, so the feed
+	// of a new follower only reaches that far back into the author's history.
+	backfillLimit int
+}
+
+// FanOut copies a new post into the timeline of every follower of its
+// author, unless the author is, or just became, a celebrity.
+func (s *TimelineStore) FanOut(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			UPDATE users SET is_celebrity = true
+			WHERE id = $1 AND NOT is_celebrity
+			AND (SELECT COUNT(*) FROM followers WHERE user_id = $1) >= $2
+		`
+
+		if _, err := tx.ExecContext(ctx, query, post.UserID, s.fanOutLimit); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO timelines (user_id, post_id, author_id, created_at)
+			SELECT f.follower_id, $1, $2, $3
+			FROM followers f
+			JOIN users u ON u.id = f.user_id
+			WHERE f.user_id = $2 AND NOT u.is_celebrity
+			ON CONFLICT DO NOTHING
+		`
+
+		_, err := tx.ExecContext(ctx, query, post.ID, post.UserID, post.CreatedAt)
+		return err
+	})
+}
+
+// Backfill copies the recent posts of a newly followed user into the
+// follower's timeline. Celebrities are skipped since the feed reads their
+// posts directly.
+func (s *TimelineStore) Backfill(ctx context.Context, followerID, userID int64) error {
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT $1, p.id, p.user_id, p.created_at
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.user_id = $2 AND NOT u.is_celebrity
+		AND p.deleted_at IS NULL AND p.status = 'published'
+		ORDER BY p.created_at DESC
+		LIMIT $3
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, followerID, userID, s.backfillLimit)
+	return err
+}
+
+// Prune removes an unfollowed user's posts from the follower's timeline.
+func (s *TimelineStore) Prune(ctx context.Context, followerID, userID int64) error {
+	query := `DELETE FROM timelines WHERE user_id = $1 AND author_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, followerID, userID)
+	return err
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrRestoreExpired = errors.New("the restore window has passed")
+
+// restore clears deleted_at on a row of table, posts or comments, trashed
+// within window. It returns ErrRestoreExpired when the row was trashed
+// earlier and ErrNotFound when it isn't in the trash.
+func restore(ctx context.Context, db *sql.DB, table string, id int64, window time.Duration) error {
+	query := `
+		UPDATE ` + table + ` SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND deleted_at >= $2
+	`
+
+	res, err := db.ExecContext(ctx, query, id, time.Now().Add(-window))
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows > 0 {
+		return nil
+	}
+
+	var trashed bool
+	query = `SELECT EXISTS (SELECT 1 FROM ` + table + ` WHERE id = $1 AND deleted_at IS NOT NULL)`
+	if err := db.QueryRowContext(ctx, query, id).Scan(&trashed); err != nil {
+		return err
+	}
+
+	if trashed {
+		return ErrRestoreExpired
+	}
+
+	return ErrNotFound
+}
+
+// purge hard-deletes the rows of table trashed longer than retention ago.
+func purge(ctx context.Context, db *sql.DB, table string, retention time.Duration) (int64, error) {
+	query := `DELETE FROM ` + table + ` WHERE deleted_at < $1`
+
+	res, err := db.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -23,6 +24,9 @@ type User struct {
 	Password password `json:"-"`
 	CreatedAt string `json:"created_at"`
 	IsActive bool `json:"is_active"`
+	IsSuspended bool `json:"is_suspended"`
+	RoleID int64 `json:"role_id"`
+	Role Role `json:"role"`
 }
 
 type password struct {
@@ -42,28 +46,41 @@ func (p *password) Set(text string) error {
 	return nil
 }
 
+func (p *password) Compare(text string) error {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
+}
+
 type UserStore struct {
 	db *sql.DB
 }
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	query := `
-		INSERT INTO users (username, password, email) VALUES ($1, $2, $3) RETURNING id,
-		created_at	
+		INSERT INTO users (username, password, email, role_id, is_active) 
+		VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4), $5) 
+		RETURNING id, created_at, role_id
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
+	role := user.Role.Name
+	if role == "" {
+		role = "user"
+	}
+
 	err := tx.QueryRowContext(
 		ctx,
 		query, 
 		user.Username,
 		user.Password.hash,
 		user.Email,
+		role,
+		user.IsActive,
 	).Scan(
 		&user.ID,
 		&user.CreatedAt,
+		&user.RoleID,
 	)
 
 	if err != nil {
@@ -82,9 +99,10 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT id, username, email, password, created_at
+		SELECT users.id, username, email, password, created_at, is_active, is_suspended, roles.id, roles.name, roles.level, COALESCE(roles.description, '')
 		FROM users 
-		WHERE id = $1;
+		JOIN roles ON users.role_id = roles.id
+		WHERE users.id = $1;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -100,8 +118,58 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 		&user.ID,
 		&user.Username,
 		&user.Email,
-		&user.Password,
+		&user.Password.hash,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.IsSuspended,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	user.RoleID = user.Role.ID
+
+	return user, nil
+}
+
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT users.id, username, email, password, created_at, is_active, is_suspended, roles.id, roles.name, roles.level, COALESCE(roles.description, '')
+		FROM users 
+		JOIN roles ON users.role_id = roles.id
+		WHERE users.email = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		email,
+	).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
 		&user.CreatedAt,
+		&user.IsActive,
+		&user.IsSuspended,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
 	)
 
 	if err != nil {
@@ -112,11 +180,14 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 			return nil, err
 		}
 	}
+	user.RoleID = user.Role.ID
 
 	return user, nil
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+// CreateAndInvite creates the user, its invitation and queues the welcome
+// email in a single transaction.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, email *OutboxEmail) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.Create(ctx, tx, user); err != nil {
 			return err
@@ -126,8 +197,102 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 			return err
 		}
 
+		if err := enqueueEmail(ctx, tx, email); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// ResendInvitation replaces any pending invitations of the inactive user by a
+// fresh one and queues the welcome email in the same transaction. The token is
+// expected to be already hashed. Users that are already active return ErrNotFound.
+func (s *UserStore) ResendInvitation(ctx context.Context, userID int64, token string, invitationExp time.Duration, email *OutboxEmail) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT id FROM users
+			WHERE id = $1 AND is_active = false
+			FOR UPDATE;
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var id int64
+		err := tx.QueryRowContext(ctx, query, userID).Scan(&id)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := s.deleteUserInvitations(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		if err := s.createUserInvitation(ctx, tx, token, invitationExp, userID); err != nil {
+			return err
+		}
+
+		return enqueueEmail(ctx, tx, email)
+	})
+}
+
+// DeleteUnactivated removes users that never activated their account and whose
+// invitations all expired more than gracePeriod ago, freeing their username and
+// email. Users that already own posts are left alone.
+func (s *UserStore) DeleteUnactivated(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	var deleted int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM users u
+			WHERE u.is_active = false
+			AND EXISTS (SELECT 1 FROM user_invitations ui WHERE ui.user_id = u.id)
+			AND NOT EXISTS (SELECT 1 FROM user_invitations ui WHERE ui.user_id = u.id AND ui.expiry > $1)
+			AND NOT EXISTS (SELECT 1 FROM posts p WHERE p.user_id = u.id)
+			RETURNING u.id
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, query, time.Now().Add(-gracePeriod))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// user_invitations has no foreign key, so clean it up by hand
+		_, err = tx.ExecContext(ctx, `DELETE FROM user_invitations WHERE user_id = ANY($1)`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		deleted = int64(len(ids))
 		return nil
 	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
 }
 
 func (s *UserStore) Activate(ctx context.Context, token string) error {
@@ -153,6 +318,123 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 	})
 }
 
+// UpdateStatus suspends or reinstates a user and records which admin did it
+// and why. Suspending a user also signs them out everywhere.
+func (s *UserStore) UpdateStatus(ctx context.Context, userID, changedBy int64, suspended bool, reason string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET is_suspended = $1 WHERE id = $2`, suspended, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		query := `
+			INSERT INTO user_status_changes (user_id, changed_by, is_suspended, reason)
+			VALUES ($1, $2, $3, $4)
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, changedBy, suspended, reason); err != nil {
+			return err
+		}
+
+		if !suspended {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+		return err
+	})
+}
+
+// CreatePasswordReset replaces the user's reset tokens by a new one and queues
+// the reset email in the same transaction. The token is expected to be already hashed.
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration, email *OutboxEmail) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// only the latest reset link is valid
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3);`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp)); err != nil {
+			return err
+		}
+
+		return enqueueEmail(ctx, tx, email)
+	})
+}
+
+func (s *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+	// 1. find the user that this token belongs to
+		query := `
+			SELECT u.id, u.username, u.email, u.created_at, u.is_active
+			FROM users u
+			JOIN password_resets pr ON u.id = pr.user_id
+			WHERE pr.token = $1 AND pr.expiry > $2;	
+		`
+
+		hash := sha256.Sum256([]byte(token))
+		hashToken := hex.EncodeToString(hash[:])
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.CreatedAt,
+			&user.IsActive,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+	// 2. update the password
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2`, user.Password.hash, user.ID); err != nil {
+			return err
+		}
+
+	// 3. sign the user out everywhere
+		if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, user.ID); err != nil {
+			return err
+		}
+
+	// 4. clean the reset tokens
+		return s.deletePasswordResets(ctx, tx, user.ID)
+	})
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
 func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
 	query := `
 		SELECT u.id, u.username, u.email, u.created_at, u.is_active
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"sync"
 )
 
@@ -13,7 +14,29 @@ type UpdatePostPayload struct {
 	Content *string `json:"content"`
 }
 
-func updatePost(postID int, p UpdatePostPayload, wg *sync.WaitGroup) {
+// token authenticates the requests, e.g. TOKEN=$(...) go run scripts/test_concurrency.go
+var token = os.Getenv("TOKEN")
+
+// fetchETag reads the ETag of the post's current version.
+func fetchETag(postID int) (string, error) {
+	url := fmt.Sprintf("http://localhost:8080/v1/posts/%d", postID)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	return resp.Header.Get("ETag"), nil
+}
+
+func updatePost(postID int, etag string, p UpdatePostPayload, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	// Construct the URL for the update endpoint
@@ -30,6 +53,9 @@ func updatePost(postID int, p UpdatePostPayload, wg *sync.WaitGroup) {
 
 	// Set headers as needed, for example:
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	// both users edit the version they read, so one of them gets a 412
+	req.Header.Set("If-Match", etag)
 
 	// Send the request
 	client := &http.Client{}
@@ -49,12 +75,18 @@ func main() {
 	// Assuming the post ID to update is 1
 	postID := 2
 
+	etag, err := fetchETag(postID)
+	if err != nil {
+		fmt.Println("Error fetching post:", err)
+		return
+	}
+
 	// Simulate User A and User B updating the same post concurrently
 	wg.Add(2)
 	content := "NEW CONTENT FROM USER B"
 	title := "NEW TITLE FROM USER A"
 
-	go updatePost(postID, UpdatePostPayload{Title: &title}, &wg)
-	go updatePost(postID, UpdatePostPayload{Content: &content}, &wg)
+	go updatePost(postID, etag, UpdatePostPayload{Title: &title}, &wg)
+	go updatePost(postID, etag, UpdatePostPayload{Content: &content}, &wg)
 	wg.Wait()
 }
\ No newline at end of file
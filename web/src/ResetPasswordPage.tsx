@@ -0,0 +1,37 @@
+import { useState } from "react"
+import { useNavigate, useParams } from "react-router-dom"
+import { API_URL } from "./App"
+
+export const ResetPasswordPage = () => {
+  const { token = '' } = useParams()
+  const [password, setPassword] = useState('')
+  const redirect = useNavigate()
+
+  const handleReset = async () => {
+    const response = await fetch(`${API_URL}/authentication/password/reset`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ token, password }),
+    })
+
+    if (response.ok) {
+      redirect("/")
+    } else {
+      // handle error
+      alert("Failed to reset password")
+    }
+  }
+
+  return (
+    <div>
+      <h1>Reset password</h1>
+      <input
+        type="password"
+        placeholder="New password"
+        value={password}
+        onChange={(e) => setPassword(e.target.value)}
+      />
+      <button onClick={handleReset}>Reset password</button>
+    </div>
+  )
+}